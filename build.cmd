@@ -1,26 +1,35 @@
 @REM https://habr.com/ru/post/249449/
 
+@REM Cross builds have no cgo, so they lack the AAC decoder and Opus encoder
+@REM and reject audio_transcode. Build on the target with the faad and opus
+@REM tags, as the Dockerfile does, to transcode audio. With MSYS2's
+@REM mingw-w64-x86_64-faad2, mingw-w64-x86_64-opus and pkgconf installed:
+@REM   set CGO_ENABLED=1
+@REM   go build -tags "faad opus" -ldflags "-s -w" -o bin/rtsp2webrtc_amd64.exe ./cmd
+
+@SET CGO_ENABLED=0
+
 @SET GOOS=windows
 @SET GOARCH=amd64
-go build -ldflags "-s -w" -o bin/rtsp2webrtc_amd64.exe
+go build -ldflags "-s -w" -o bin/rtsp2webrtc_amd64.exe ./cmd
 
 @SET GOOS=linux
 @SET GOARCH=386
-go build -ldflags "-s -w" -o bin/rtsp2webrtc_i386
+go build -ldflags "-s -w" -o bin/rtsp2webrtc_i386 ./cmd
 
 @SET GOOS=linux
 @SET GOARCH=amd64
-go build -ldflags "-s -w" -o bin/rtsp2webrtc_amd64
+go build -ldflags "-s -w" -o bin/rtsp2webrtc_amd64 ./cmd
 
 @SET GOOS=linux
 @SET GOARCH=arm
 @SET GOARM=7
-go build -ldflags "-s -w" -o bin/rtsp2webrtc_armv7
+go build -ldflags "-s -w" -o bin/rtsp2webrtc_armv7 ./cmd
 
 @SET GOOS=linux
 @SET GOARCH=arm64
-go build -ldflags "-s -w" -o bin/rtsp2webrtc_aarch64
+go build -ldflags "-s -w" -o bin/rtsp2webrtc_aarch64 ./cmd
 
 @SET GOOS=darwin
 @SET GOARCH=amd64
-go build -ldflags "-s -w" -o bin/rtsp2webrtc_darwin
+go build -ldflags "-s -w" -o bin/rtsp2webrtc_darwin ./cmd
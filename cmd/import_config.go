@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
+	"github.com/DaffaJatmiko/stream_camera/internal/usecase"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/DaffaJatmiko/stream_camera/pkg/database"
+)
+
+const importConfigUsage = "usage: import-config [-dry_run] [config flags]"
+
+// runImportConfig implements the "import-config" subcommand
+func runImportConfig(args []string) {
+	dryRun := false
+	if len(args) > 0 && (args[0] == "-dry_run" || args[0] == "--dry_run") {
+		dryRun, args = true, args[1:]
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatal("Failed to load configuration: ", err)
+	}
+	if cfg.FilePath() == "" {
+		log.Fatal("No config file found; pass -config. ", importConfigUsage)
+	}
+	db, err := database.New(cfg.Database)
+	if err != nil {
+		log.Fatal("Failed to initialize database: ", err)
+	}
+	defer db.Close()
+
+	auditUsecase := usecase.NewAuditUseCase(repository.NewAuditRepository(db.DB))
+	streamUsecase := usecase.NewStreamUseCase(repository.NewStreamRepository(db.DB), auditUsecase)
+
+	report, err := streamUsecase.ImportConfigStreams(models.SystemActor, dryRun)
+	if err != nil {
+		log.Fatal("Failed to import streams: ", err)
+	}
+	printImportReport(report)
+}
+
+// importConfigStreams runs the startup import enabled by
+// database.import_config_streams
+func importConfigStreams(streamUsecase usecase.StreamUseCase) {
+	report, err := streamUsecase.ImportConfigStreams(models.SystemActor, false)
+	if err != nil {
+		log.Printf("Failed to import config file streams: %v", err)
+		return
+	}
+	log.Printf("Imported config file streams: created=%d skipped=%d failed=%d", report.Created, report.Skipped, report.Failed)
+	for _, row := range report.Rows {
+		if row.Status == models.StreamImportFailed {
+			log.Printf("Config file stream %s not imported: %s", row.Name, row.Error)
+		}
+	}
+}
+
+func printImportReport(report *models.StreamImportReport) {
+	for _, row := range report.Rows {
+		detail := row.UUID
+		if row.Reason != "" {
+			detail += " (" + row.Reason + ")"
+		}
+		if row.Error != "" {
+			detail = row.Error
+		}
+		fmt.Printf("%-8s %-32s %s\n", row.Status, row.Name, detail)
+	}
+	verb := "imported"
+	if report.DryRun {
+		verb = "would import"
+	}
+	fmt.Printf("%s: %d created, %d skipped, %d failed\n", verb, report.Created, report.Skipped, report.Failed)
+}
@@ -5,57 +5,153 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/DaffaJatmiko/stream_camera/internal/delivery/http"
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
 	"github.com/DaffaJatmiko/stream_camera/internal/repository"
 	"github.com/DaffaJatmiko/stream_camera/internal/usecase"
 	"github.com/DaffaJatmiko/stream_camera/pkg/config"
 	"github.com/DaffaJatmiko/stream_camera/pkg/database"
+	"github.com/DaffaJatmiko/stream_camera/pkg/filewatch"
 	"github.com/DaffaJatmiko/stream_camera/pkg/streaming"
+	"github.com/DaffaJatmiko/stream_camera/pkg/turnserver"
+	"github.com/DaffaJatmiko/stream_camera/pkg/webrtc"
 )
 
+// configPollInterval is how often the config file is checked for changes
+const configPollInterval = 2 * time.Second
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import-config" {
+		runImportConfig(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "issue-token" {
+		runIssueToken(os.Args[2:])
+		return
+	}
+
 	// Initialize config
-	cfg := config.GetInstance()
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("Failed to load configuration: ", err)
+	}
 
 	// Initialize database
-	db, err := database.NewPostgresDB()
+	db, err := database.New(cfg.Database)
 	if err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 
 	// Initialize repository
 	streamRepo := repository.NewStreamRepository(db.DB)
+	auditRepo := repository.NewAuditRepository(db.DB)
+
+	// Start the embedded TURN server
+	var relay *turnserver.Server
+	if cfg.Server.TURN.Enabled {
+		relay, err = turnserver.Start(cfg.Server.TURN, cfg.Server.TLS)
+		if err != nil {
+			log.Fatal("Failed to start TURN server: ", err)
+		}
+		defer relay.Close()
+		log.Printf("TURN server listening on %s", cfg.Server.TURN.Listen)
+	}
+
+	// Share WebRTC ports between sessions
+	var iceMux *webrtc.ICEMux
+	if cfg.Server.WebRTCUDPPort > 0 || cfg.Server.WebRTCTCPPort > 0 {
+		iceMux, err = webrtc.NewICEMux(cfg.Server.WebRTCUDPPort, cfg.Server.WebRTCTCPPort)
+		if err != nil {
+			log.Fatal("Failed to open WebRTC ports: ", err)
+		}
+		defer iceMux.Close()
+		log.Printf("WebRTC sessions share UDP port %d and TCP port %d", cfg.Server.WebRTCUDPPort, cfg.Server.WebRTCTCPPort)
+	}
+
+	// Initialize usecases
+	auditUsecase := usecase.NewAuditUseCase(auditRepo)
+	streamUsecase := usecase.NewStreamUseCase(streamRepo, auditUsecase)
+	webrtcUsecase := usecase.NewWebRTCUseCase(streamRepo, relay, iceMux)
+
+	if cfg.Database.ImportConfigStreams {
+		importConfigStreams(streamUsecase)
+	}
 
 	// Initialize streaming manager
 	streamManager := streaming.NewManager(streamRepo)
 	go streamManager.Start()
-
-	// Initialize usecases
-	streamUsecase := usecase.NewStreamUseCase(streamRepo)
-	webrtcUsecase := usecase.NewWebRTCUseCase(streamRepo)
+	go streamManager.RunEphemeralGC()
 
 	// Initialize HTTP server
-	router := http.NewRouter(streamUsecase, webrtcUsecase)
-	go router.Run(cfg.Server.HTTPPort)
-	//go func() {
-	//	if err := router.Run(cfg.Server.HTTPPort); err != nil {
-	//		log.Fatal("Failed to start HTTP server:", err)
-	//	}
-	//}()
+	router, err := http.NewRouter(streamUsecase, webrtcUsecase, auditUsecase)
+	if err != nil {
+		log.Fatal("Failed to initialize HTTP server: ", err)
+	}
+	go func() {
+		if err := router.Run(cfg.Server.HTTPPort); err != nil {
+			log.Fatal("Failed to start HTTP server:", err)
+		}
+	}()
+
+	// Reload configuration on SIGHUP and when the config or env file changes
+	reload := func(trigger string) {
+		reloadConfig(streamManager, auditUsecase, trigger)
+	}
+	watched := []string{cfg.EnvFilePath()}
+	if path := cfg.FilePath(); path != "" {
+		watched = append(watched, path)
+	}
+	watcher := filewatch.New(configPollInterval, func() { reload("file change") }, watched...)
+	watcher.Start()
+	defer watcher.Stop()
 
 	// Wait for shutdown signal
 	sigs := make(chan os.Signal, 1)
 	done := make(chan bool, 1)
-	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	go func() {
-		sig := <-sigs
-		log.Println(sig)
-		done <- true
+		for sig := range sigs {
+			if sig == syscall.SIGHUP {
+				reload("SIGHUP")
+				continue
+			}
+			log.Println(sig)
+			done <- true
+			return
+		}
 	}()
 
 	log.Println("Server Start Awaiting Signal")
 	<-done
 	log.Println("Exiting")
 }
+
+// reloadConfig applies the current configuration sources and records the
+// outcome in the log and the audit trail.
+func reloadConfig(manager *streaming.Manager, audit usecase.AuditUseCase, trigger string) {
+	result, err := manager.Reload()
+	if err != nil {
+		log.Printf("Configuration reload (%s) rejected: %v", trigger, err)
+		audit.Record(models.SystemActor, models.AuditActionConfigReject, "config", nil, map[string]string{
+			"trigger": trigger,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	log.Printf("Configuration reloaded (%s): added=%v removed=%v changed=%v", trigger, result.Added, result.Removed, result.Changed)
+	if len(result.RestartRequired) > 0 {
+		log.Printf("Configuration changes that need a restart: %v", result.RestartRequired)
+	}
+	audit.Record(models.SystemActor, models.AuditActionConfigReload, "config", nil, map[string]interface{}{
+		"trigger": trigger,
+		"result":  result,
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/DaffaJatmiko/stream_camera/pkg/database"
+)
+
+const migrateUsage = "usage: migrate up|down [steps]|status [config flags]"
+
+// runMigrate implements the "migrate" subcommand
+func runMigrate(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+	action, args := args[0], args[1:]
+
+	steps := 1
+	if action == "down" && len(args) > 0 {
+		if n, err := strconv.Atoi(args[0]); err == nil {
+			if n < 1 {
+				log.Fatal("migrate down: steps must be at least 1")
+			}
+			steps, args = n, args[1:]
+		}
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatal("Failed to load configuration: ", err)
+	}
+	db, err := database.Open(cfg.Database)
+	if err != nil {
+		log.Fatal("Failed to open database: ", err)
+	}
+	defer db.Close()
+
+	migrator, err := db.NewMigrator()
+	if err != nil {
+		log.Fatal("Failed to load migrations: ", err)
+	}
+
+	switch action {
+	case "up":
+		applied, err := migrator.Up()
+		for _, migration := range applied {
+			fmt.Printf("applied  %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		reverted, err := migrator.Down(steps)
+		for _, migration := range reverted {
+			fmt.Printf("reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "status":
+		current, err := migrator.Current()
+		if err != nil {
+			log.Fatal(err)
+		}
+		status, err := migrator.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("schema version %d, binary supports %d\n", current, migrator.Latest())
+		for _, entry := range status {
+			applied := "pending"
+			if entry.AppliedAt != nil {
+				applied = entry.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", entry.Version, entry.Name, applied)
+		}
+		if current > migrator.Latest() {
+			os.Exit(1)
+		}
+	default:
+		log.Fatal(migrateUsage)
+	}
+}
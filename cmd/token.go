@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/auth"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+)
+
+const (
+	tokenUsage      = "usage: issue-token <name> [ttl] [config flags]"
+	defaultTokenTTL = 24 * time.Hour
+)
+
+// runIssueToken implements the "issue-token" subcommand, printing a bearer
+// token for an operator signed with server.auth.token_secret
+func runIssueToken(args []string) {
+	if len(args) == 0 {
+		log.Fatal(tokenUsage)
+	}
+	name, args := args[0], args[1:]
+
+	ttl := defaultTokenTTL
+	if len(args) > 0 {
+		if d, err := time.ParseDuration(args[0]); err == nil {
+			if d <= 0 {
+				log.Fatal("issue-token: ttl must be positive")
+			}
+			ttl, args = d, args[1:]
+		}
+	}
+
+	cfg, err := config.Load(args)
+	if err != nil {
+		log.Fatal("Failed to load configuration: ", err)
+	}
+	token, err := auth.Issue(cfg.Server.Auth.TokenSecret, name, time.Now().Add(ttl))
+	if err != nil {
+		log.Fatal("issue-token: ", err)
+	}
+	fmt.Println(token)
+}
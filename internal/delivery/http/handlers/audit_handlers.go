@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	auditUseCase usecase.AuditUseCase
+}
+
+func NewAuditHandler(auditUseCase usecase.AuditUseCase) *AuditHandler {
+	return &AuditHandler{
+		auditUseCase: auditUseCase,
+	}
+}
+
+// GetAuditLog lists audit entries filtered by actor, ip, action, resource
+// and an RFC 3339 time range, newest first.
+func (h *AuditHandler) GetAuditLog(c *gin.Context) {
+	filter := models.AuditFilter{
+		Actor:    c.Query("actor"),
+		SourceIP: c.Query("ip"),
+		Action:   c.Query("action"),
+		Resource: c.Query("resource"),
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c, "from"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.To, err = parseTimeQuery(c, "to"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Page, err = parseIntQuery(c, "page"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.PageSize, err = parseIntQuery(c, "page_size"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.auditUseCase.List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
+func parseTimeQuery(c *gin.Context, key string) (time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: must be an RFC 3339 timestamp", key)
+	}
+	return t, nil
+}
+
+func parseIntQuery(c *gin.Context, key string) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s: must be a non-negative integer", key)
+	}
+	return n, nil
+}
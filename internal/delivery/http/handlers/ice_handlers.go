@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/delivery/http/middleware"
+	"github.com/DaffaJatmiko/stream_camera/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+// GetICEServers returns the ICE servers a viewer should use. Only
+// authenticated viewers are given TURN credentials.
+func (h *WebRTCHandler) GetICEServers(c *gin.Context) {
+	servers, err := h.webrtcUseCase.GetICEServers(middleware.Actor(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, servers)
+}
+
+// GetTURNStats returns the use of the embedded TURN server
+func (h *WebRTCHandler) GetTURNStats(c *gin.Context) {
+	stats, err := h.webrtcUseCase.GetTURNStats()
+	switch {
+	case errors.Is(err, usecase.ErrTURNDisabled):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, stats)
+	}
+}
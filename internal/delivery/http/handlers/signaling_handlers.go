@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/delivery/http/middleware"
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/usecase"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	signalingPongWait   = 60 * time.Second
+	signalingPingPeriod = 25 * time.Second
+	signalingWriteWait  = 10 * time.Second
+	signalingMaxMessage = 64 << 10
+)
+
+// signalingConn serialises writes to a signaling WebSocket
+type signalingConn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+}
+
+func (c *signalingConn) send(msg models.SignalMessage) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ws.SetWriteDeadline(time.Now().Add(signalingWriteWait))
+	return c.ws.WriteJSON(msg)
+}
+
+func (c *signalingConn) ping() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(signalingWriteWait))
+}
+
+// HandleSignaling runs a trickle ICE session for a stream over a WebSocket.
+// The session survives the WebSocket until its peer connection closes, so a
+// client can reconnect, resume it and restart ICE.
+func (h *WebRTCHandler) HandleSignaling(c *gin.Context) {
+	streamID := c.Param("uuid")
+	ws, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		log.Printf("[HandleSignaling] Upgrade error: %v", err)
+		return
+	}
+	defer ws.Close()
+	conn := &signalingConn{ws: ws}
+
+	ws.SetReadLimit(signalingMaxMessage)
+	ws.SetReadDeadline(time.Now().Add(signalingPongWait))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(signalingPongWait))
+	})
+
+	closed := make(chan struct{})
+	defer close(closed)
+	messages := make(chan models.SignalMessage)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			var msg models.SignalMessage
+			if err := ws.ReadJSON(&msg); err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-closed:
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(signalingPingPeriod)
+	defer ping.Stop()
+
+	var session *usecase.SignalSession
+	var events <-chan models.SignalMessage
+	var detached, done <-chan struct{}
+	defer func() {
+		if session != nil {
+			session.Detach(detached)
+		}
+	}()
+	for {
+		select {
+		case msg := <-messages:
+			next, reply := h.handleSignal(middleware.Actor(c), streamID, session, msg)
+			if next != session {
+				session = next
+				events, detached = session.Attach()
+				done = session.Done()
+			}
+			for _, out := range reply {
+				if err := conn.send(out); err != nil {
+					return
+				}
+			}
+		case event := <-events:
+			if err := conn.send(event); err != nil {
+				return
+			}
+		case <-detached:
+			conn.send(models.SignalMessage{Type: models.SignalError, Error: "session resumed on another connection"})
+			return
+		case <-done:
+			conn.send(models.SignalMessage{Type: models.SignalClosed, Session: session.ID})
+			return
+		case <-ping.C:
+			if err := conn.ping(); err != nil {
+				return
+			}
+		case err := <-readErr:
+			if session != nil {
+				log.Printf("[HandleSignaling] Session %s detached: %v", session.ID, err)
+			}
+			return
+		}
+	}
+}
+
+// handleSignal applies one client message and returns the session it leaves
+// attached and the replies to send
+func (h *WebRTCHandler) handleSignal(actor models.Actor, streamID string, session *usecase.SignalSession, msg models.SignalMessage) (*usecase.SignalSession, []models.SignalMessage) {
+	fail := func(err error) (*usecase.SignalSession, []models.SignalMessage) {
+		return session, []models.SignalMessage{{Type: models.SignalError, Error: err.Error()}}
+	}
+
+	switch msg.Type {
+	case models.SignalOffer:
+		if session != nil {
+			answer, err := session.Restart(msg.Sdp64)
+			if err != nil {
+				return fail(err)
+			}
+			return session, []models.SignalMessage{{Type: models.SignalAnswer, Session: session.ID, Sdp64: answer}}
+		}
+		started, answer, err := h.webrtcUseCase.StartSession(actor, streamID, msg.Sdp64)
+		if err != nil {
+			log.Printf("[HandleSignaling] Stream %s: %v", streamID, err)
+			return fail(err)
+		}
+		return started, []models.SignalMessage{
+			{Type: models.SignalSession, Session: started.ID, ResumeToken: started.ResumeToken()},
+			{Type: models.SignalAnswer, Session: started.ID, Sdp64: answer},
+		}
+
+	case models.SignalResume:
+		if session != nil {
+			return fail(errors.New("a session is already attached"))
+		}
+		resumed, token, err := h.webrtcUseCase.ResumeSession(actor, streamID, msg.Session, msg.ResumeToken)
+		if err != nil {
+			return fail(err)
+		}
+		return resumed, []models.SignalMessage{{Type: models.SignalSession, Session: resumed.ID, ResumeToken: token}}
+
+	case models.SignalCandidate:
+		if session == nil {
+			return fail(usecase.ErrSessionNotFound)
+		}
+		if msg.Candidate == nil || msg.Candidate.Candidate == "" {
+			return session, nil
+		}
+		if err := session.AddCandidate(*msg.Candidate); err != nil {
+			return fail(err)
+		}
+		return session, nil
+
+	default:
+		return fail(errors.New("unknown message type " + msg.Type))
+	}
+}
@@ -1,9 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 
+	"github.com/DaffaJatmiko/stream_camera/internal/delivery/http/middleware"
 	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
 	"github.com/DaffaJatmiko/stream_camera/internal/usecase"
 	"github.com/gin-gonic/gin"
 )
@@ -18,50 +24,134 @@ func NewStreamHandler(streamUseCase usecase.StreamUseCase) *StreamHandler {
 	}
 }
 
+// GetStreamList lists every stream as a plain array, accepting the same
+// filters as ListStreams. It backs the legacy GET /streams route.
 func (h *StreamHandler) GetStreamList(c *gin.Context) {
-	streams, err := h.streamUseCase.GetAllStreams()
+	filter, err := parseStreamFilter(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	streams, err := h.streamUseCase.GetAllStreams(filter)
+	if err != nil {
+		respondStreamError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, streams)
 }
 
+// ListStreams returns a page of streams. Filters: ?tag= (repeatable), ?site=,
+// ?group=, ?on_demand=, ?live= and a free text ?q= search. Paging: ?sort=,
+// ?order=asc|desc, ?limit= and the ?cursor= returned as next_cursor.
+func (h *StreamHandler) ListStreams(c *gin.Context) {
+	filter, err := parseStreamFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if filter.Limit, err = parseIntQuery(c, "limit"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	filter.Cursor = c.Query("cursor")
+
+	page, err := h.streamUseCase.ListStreams(filter)
+	if err != nil {
+		respondStreamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, page)
+}
+
 func (h *StreamHandler) GetStream(c *gin.Context) {
 	uuid := c.Param("uuid")
 	stream, err := h.streamUseCase.GetStream(uuid)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Stream not found"})
+		respondStreamError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, stream)
 }
 
+// GetStreamStats reports whether the stream's worker is connected, its
+// viewers, the codecs it sends and the cost of audio transcoding
+func (h *StreamHandler) GetStreamStats(c *gin.Context) {
+	stats, err := h.streamUseCase.GetStreamStats(c.Param("uuid"))
+	if err != nil {
+		respondStreamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// GetViewerStats reports the connection quality of each WebRTC viewer
+func (h *StreamHandler) GetViewerStats(c *gin.Context) {
+	viewers, err := h.streamUseCase.GetViewerStats(c.Param("uuid"))
+	if err != nil {
+		respondStreamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, viewers)
+}
+
+// KickViewer disconnects a viewer listed by GetViewerStats
+func (h *StreamHandler) KickViewer(c *gin.Context) {
+	if err := h.streamUseCase.KickViewer(middleware.Actor(c), c.Param("uuid"), c.Param("viewer")); err != nil {
+		respondStreamError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
 func (h *StreamHandler) CreateStream(c *gin.Context) {
-	var stream models.Stream
-	if err := c.ShouldBindJSON(&stream); err != nil {
+	var req models.StreamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.streamUseCase.CreateStream(&stream); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	requireProbe, err := parseBoolQuery(c, "require_probe")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	stream, err := h.streamUseCase.CreateStream(middleware.Actor(c), req, requireProbe != nil && *requireProbe)
+	if err != nil {
+		respondStreamError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, stream)
 }
 
+// ProbeStream test-connects to an RTSP source without saving it
+func (h *StreamHandler) ProbeStream(c *gin.Context) {
+	var req models.StreamProbeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.streamUseCase.ProbeStream(req)
+	if err != nil {
+		respondStreamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 func (h *StreamHandler) UpdateStream(c *gin.Context) {
 	uuid := c.Param("uuid")
-	var stream models.Stream
-	if err := c.ShouldBindJSON(&stream); err != nil {
+	var req models.StreamRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.streamUseCase.UpdateStream(uuid, &stream); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	stream, err := h.streamUseCase.UpdateStream(middleware.Actor(c), uuid, req)
+	if err != nil {
+		respondStreamError(c, err)
 		return
 	}
 
@@ -70,9 +160,94 @@ func (h *StreamHandler) UpdateStream(c *gin.Context) {
 
 func (h *StreamHandler) DeleteStream(c *gin.Context) {
 	uuid := c.Param("uuid")
-	if err := h.streamUseCase.DeleteStream(uuid); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.streamUseCase.DeleteStream(middleware.Actor(c), uuid); err != nil {
+		respondStreamError(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Stream deleted successfully"})
 }
+
+func (h *StreamHandler) GetDeletedStreams(c *gin.Context) {
+	streams, err := h.streamUseCase.GetDeletedStreams()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, streams)
+}
+
+func (h *StreamHandler) RestoreStream(c *gin.Context) {
+	uuid := c.Param("uuid")
+	if err := h.streamUseCase.RestoreStream(middleware.Actor(c), uuid); err != nil {
+		respondStreamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Stream restored successfully"})
+}
+
+func (h *StreamHandler) PurgeStream(c *gin.Context) {
+	uuid := c.Param("uuid")
+	if err := h.streamUseCase.PurgeStream(middleware.Actor(c), uuid); err != nil {
+		respondStreamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Stream purged successfully"})
+}
+
+func parseStreamFilter(c *gin.Context) (models.StreamFilter, error) {
+	filter := models.StreamFilter{
+		Tags:   c.QueryArray("tag"),
+		Site:   c.Query("site"),
+		Group:  c.Query("group"),
+		Search: strings.TrimSpace(c.Query("q")),
+		Sort:   c.Query("sort"),
+	}
+
+	var err error
+	if filter.OnDemand, err = parseBoolQuery(c, "on_demand"); err != nil {
+		return filter, err
+	}
+	if filter.Live, err = parseBoolQuery(c, "live"); err != nil {
+		return filter, err
+	}
+	switch c.Query("order") {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return filter, errors.New("invalid order: must be asc or desc")
+	}
+	return filter, nil
+}
+
+func parseBoolQuery(c *gin.Context, key string) (*bool, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: must be true or false", key)
+	}
+	return &b, nil
+}
+
+// respondStreamError maps repository and validation errors to HTTP statuses
+func respondStreamError(c *gin.Context, err error) {
+	var probeErr *usecase.ProbeFailedError
+	switch {
+	case errors.As(err, &probeErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "probe": probeErr.Result})
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream not found"})
+	case errors.Is(err, repository.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Stream conflicts with an existing stream"})
+	case errors.Is(err, usecase.ErrInvalidStreamName), errors.Is(err, usecase.ErrInvalidStreamLocation),
+		errors.Is(err, usecase.ErrInvalidAudioTranscode), errors.Is(err, usecase.ErrAudioTranscodeUnavailable),
+		errors.Is(err, repository.ErrInvalidSort), errors.Is(err, repository.ErrInvalidCursor),
+		errors.Is(err, usecase.ErrInvalidProbeURL):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
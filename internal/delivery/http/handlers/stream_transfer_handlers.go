@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/delivery/http/middleware"
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/usecase"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// PassphraseHeader carries the passphrase encrypting exported credentials
+	PassphraseHeader = "X-Credential-Passphrase"
+
+	maxImportSize = 10 << 20
+	tagSeparator  = ";"
+)
+
+// streamCSVColumns is the column order of CSV exports. Imports match
+// columns by header name, so they may come in any order.
+var streamCSVColumns = []string{
+	"name", "display_name", "description", "site", "group", "latitude", "longitude",
+	"tags", "metadata", "url", "on_demand", "debug", "disable_audio", "audio_transcode", "backchannel", "credentials",
+}
+
+// ImportStreams bulk creates streams from a JSON array, a JSON export or a
+// CSV file (Content-Type text/csv). ?dry_run=true only validates and
+// ?upsert=true updates streams whose name already exists.
+func (h *StreamHandler) ImportStreams(c *gin.Context) {
+	dryRun, err := parseBoolQuery(c, "dry_run")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	upsert, err := parseBoolQuery(c, "upsert")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	opts := models.StreamImportOptions{
+		DryRun:     dryRun != nil && *dryRun,
+		Upsert:     upsert != nil && *upsert,
+		Passphrase: c.GetHeader(PassphraseHeader),
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "import is larger than 10 MiB"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var records []models.StreamRecord
+	if c.ContentType() == "text/csv" {
+		records, err = decodeStreamCSV(body)
+	} else {
+		records, err = decodeStreamJSON(body)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.streamUseCase.ImportStreams(middleware.Actor(c), records, opts)
+	if err != nil {
+		respondStreamError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// ExportStreams dumps the stream inventory as JSON or, with ?format=csv, as
+// CSV. Credentials are stripped from URLs unless ?credentials=true, in which
+// case they are encrypted with the passphrase header or the configured key.
+func (h *StreamHandler) ExportStreams(c *gin.Context) {
+	includeCredentials, err := parseBoolQuery(c, "credentials")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "csv" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid format: must be json or csv"})
+		return
+	}
+
+	inventory, err := h.streamUseCase.ExportStreams(includeCredentials != nil && *includeCredentials, c.GetHeader(PassphraseHeader))
+	if err != nil {
+		if errors.Is(err, usecase.ErrCredentialKeyRequired) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		respondStreamError(c, err)
+		return
+	}
+
+	filename := "streams-" + inventory.ExportedAt.Format("20060102-150405") + "." + format
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	if format == "json" {
+		c.JSON(http.StatusOK, inventory)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := encodeStreamCSV(&buf, inventory.Streams); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.Data(http.StatusOK, "text/csv; charset=utf-8", buf.Bytes())
+}
+
+// decodeStreamJSON accepts a bare array of records or a full export
+func decodeStreamJSON(body []byte) ([]models.StreamRecord, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var records []models.StreamRecord
+		if err := json.Unmarshal(trimmed, &records); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return records, nil
+	}
+
+	var inventory models.StreamInventory
+	if err := json.Unmarshal(trimmed, &inventory); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if inventory.Version > models.StreamInventoryVersion {
+		return nil, fmt.Errorf("unsupported export version %d", inventory.Version)
+	}
+	return inventory.Streams, nil
+}
+
+func decodeStreamCSV(body []byte) ([]models.StreamRecord, error) {
+	reader := csv.NewReader(bytes.NewReader(body))
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV header: %w", err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		if !containsString(streamCSVColumns, name) {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["url"]; !ok {
+		return nil, errors.New("CSV is missing the url column")
+	}
+
+	var records []models.StreamRecord
+	for row := 1; ; row++ {
+		fields, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		get := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(fields[i])
+			}
+			return ""
+		}
+
+		record := models.StreamRecord{
+			Name:           get("name"),
+			DisplayName:    get("display_name"),
+			Description:    get("description"),
+			Site:           get("site"),
+			Group:          get("group"),
+			URL:            get("url"),
+			AudioTranscode: get("audio_transcode"),
+			Credentials:    get("credentials"),
+		}
+		if tags := get("tags"); tags != "" {
+			record.Tags = strings.Split(tags, tagSeparator)
+		}
+		if metadata := get("metadata"); metadata != "" {
+			if err := json.Unmarshal([]byte(metadata), &record.Metadata); err != nil {
+				return nil, fmt.Errorf("row %d: metadata must be a JSON object", row)
+			}
+		}
+		if record.Latitude, err = parseOptionalFloat(get("latitude")); err != nil {
+			return nil, fmt.Errorf("row %d: invalid latitude", row)
+		}
+		if record.Longitude, err = parseOptionalFloat(get("longitude")); err != nil {
+			return nil, fmt.Errorf("row %d: invalid longitude", row)
+		}
+		if record.OnDemand, err = parseOptionalBool(get("on_demand")); err != nil {
+			return nil, fmt.Errorf("row %d: invalid on_demand", row)
+		}
+		if record.Debug, err = parseOptionalBool(get("debug")); err != nil {
+			return nil, fmt.Errorf("row %d: invalid debug", row)
+		}
+		if record.DisableAudio, err = parseOptionalBool(get("disable_audio")); err != nil {
+			return nil, fmt.Errorf("row %d: invalid disable_audio", row)
+		}
+		if record.Backchannel, err = parseOptionalBool(get("backchannel")); err != nil {
+			return nil, fmt.Errorf("row %d: invalid backchannel", row)
+		}
+		records = append(records, record)
+	}
+}
+
+func encodeStreamCSV(w io.Writer, records []models.StreamRecord) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(streamCSVColumns); err != nil {
+		return err
+	}
+	for _, record := range records {
+		var metadata string
+		if len(record.Metadata) > 0 {
+			b, err := json.Marshal(record.Metadata)
+			if err != nil {
+				return err
+			}
+			metadata = string(b)
+		}
+		if err := writer.Write([]string{
+			record.Name,
+			record.DisplayName,
+			record.Description,
+			record.Site,
+			record.Group,
+			formatOptionalFloat(record.Latitude),
+			formatOptionalFloat(record.Longitude),
+			strings.Join(record.Tags, tagSeparator),
+			metadata,
+			record.URL,
+			strconv.FormatBool(record.OnDemand),
+			strconv.FormatBool(record.Debug),
+			strconv.FormatBool(record.DisableAudio),
+			record.AudioTranscode,
+			strconv.FormatBool(record.Backchannel),
+			record.Credentials,
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func parseOptionalFloat(value string) (*float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+func formatOptionalFloat(f *float64) string {
+	if f == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*f, 'f', -1, 64)
+}
+
+func parseOptionalBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -2,68 +2,71 @@ package handlers
 
 import (
 	"encoding/json"
-	"github.com/deepch/vdk/av"
+	"errors"
 	"log"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/DaffaJatmiko/stream_camera/internal/delivery/http/middleware"
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
 	"github.com/DaffaJatmiko/stream_camera/internal/usecase"
 	"github.com/DaffaJatmiko/stream_camera/pkg/config"
-	webrtc "github.com/deepch/vdk/format/webrtcv3"
+	"github.com/DaffaJatmiko/stream_camera/pkg/webrtc"
 	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
 )
 
+// peerConnectionRetryAfter is advertised when a client hits its peer connection limit
+const peerConnectionRetryAfter = 10 * time.Second
+
+// CodecInfo keeps the legacy Type key and adds the track's descriptor
 type CodecInfo struct {
-	Type string `json:"Type"`
+	Type       string                 `json:"Type"`
+	Codec      string                 `json:"Codec"`
+	Descriptor models.CodecDescriptor `json:"descriptor"`
 }
 
 type WebRTCHandler struct {
 	webrtcUseCase usecase.WebRTCUseCase
 	cfg           *config.Config
+	upgrader      websocket.Upgrader
 }
 
 func NewWebRTCHandler(webrtcUseCase usecase.WebRTCUseCase) *WebRTCHandler {
+	cfg := config.GetInstance()
 	return &WebRTCHandler{
 		webrtcUseCase: webrtcUseCase,
-		cfg:           config.GetInstance(),
+		cfg:           cfg,
+		upgrader:      websocket.Upgrader{CheckOrigin: middleware.CheckOrigin(cfg.GetCORS())},
 	}
 }
 
-// GetStreamCodec handles codec information retrieval for a stream
+// GetStreamCodec lists the tracks a viewer of the stream will receive. With
+// ?codecs=H264,H265 it answers 406 when the client cannot play the video.
 func (h *WebRTCHandler) GetStreamCodec(c *gin.Context) {
 	streamID := c.Param("uuid")
 	log.Printf("[GetStreamCodec] Called with Stream ID: %s", streamID)
 
-	if !h.cfg.StreamExists(streamID) {
-		log.Printf("[GetStreamCodec] Stream %s not found", streamID)
+	tracks, err := h.webrtcUseCase.GetStreamTracks(streamID)
+	if err != nil {
+		log.Printf("[GetStreamCodec] Stream %s: %v", streamID, err)
 		c.Writer.Write([]byte(""))
 		return
 	}
 
-	h.cfg.StartStreamIfNotRunning(streamID)
-	codecs := h.cfg.GetStreamCodecs(streamID)
-	if codecs == nil {
-		log.Printf("[GetStreamCodec] No codecs for stream %s", streamID)
-		c.Writer.Write([]byte(""))
-		return
+	if clientCodecs := c.Query("codecs"); clientCodecs != "" {
+		if err := usecase.CheckClientCodecs(tracks, strings.Split(clientCodecs, ",")); err != nil {
+			log.Printf("[GetStreamCodec] Stream %s: %v", streamID, err)
+			c.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
+			return
+		}
 	}
 
 	var tmpCodec []CodecInfo
-	for _, codec := range codecs {
-		if codec.Type() != av.H264 &&
-			codec.Type() != av.PCM_ALAW &&
-			codec.Type() != av.PCM_MULAW &&
-			codec.Type() != av.OPUS {
-			log.Printf("[GetStreamCodec] Codec Not Supported WebRTC ignore this track: %v", codec.Type())
-			continue
-		}
-		if codec.Type().IsVideo() {
-			tmpCodec = append(tmpCodec, CodecInfo{Type: "video"})
-			log.Printf("[GetStreamCodec] Added video codec")
-		} else {
-			tmpCodec = append(tmpCodec, CodecInfo{Type: "audio"})
-			log.Printf("[GetStreamCodec] Added audio codec")
-		}
+	for _, track := range tracks {
+		tmpCodec = append(tmpCodec, CodecInfo{Type: track.Type, Codec: track.Codec, Descriptor: track})
 	}
 
 	b, err := json.Marshal(tmpCodec)
@@ -77,6 +80,30 @@ func (h *WebRTCHandler) GetStreamCodec(c *gin.Context) {
 	c.Writer.Write(b)
 }
 
+// NegotiateStreamCodec matches the stream's tracks against the codecs or SDP
+// offer posted by the client and recommends a transport
+func (h *WebRTCHandler) NegotiateStreamCodec(c *gin.Context) {
+	var req models.CodecNegotiationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.webrtcUseCase.NegotiateCodecs(c.Param("uuid"), req)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Stream not found"})
+	case errors.Is(err, usecase.ErrNoClientCapabilities), errors.Is(err, usecase.ErrInvalidOffer):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, usecase.ErrStreamCodecNotFound):
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusOK, result)
+	}
+}
+
 // HandleWebRTCWithUUID processes WebRTC connections for a specific stream
 func (h *WebRTCHandler) HandleWebRTCWithUUID(c *gin.Context) {
 	streamID := c.Param("uuid")
@@ -95,24 +122,32 @@ func (h *WebRTCHandler) HandleWebRTCWithUUID(c *gin.Context) {
 		return
 	}
 
-	var AudioOnly bool
-	if len(codecs) == 1 && codecs[0].Type().IsAudio() {
-		AudioOnly = true
+	release, err := h.webrtcUseCase.AcquirePeerConnection(c.ClientIP())
+	if err != nil {
+		log.Printf("[HandleWebRTCWithUUID] Rejected %s: %v", c.ClientIP(), err)
+		middleware.AbortTooManyRequests(c, peerConnectionRetryAfter)
+		return
+	}
+
+	stream, _ := h.cfg.GetStream(streamID)
+	AudioOnly := usecase.IsAudioOnly(usecase.BuildTracks(codecs, stream.DisableAudio))
+	if AudioOnly {
 		log.Printf("[HandleWebRTCWithUUID] Stream %s is audio only", streamID)
 	}
 
 	log.Printf("[HandleWebRTCWithUUID] Setting up ICE Servers: %v", h.cfg.GetICEServers())
-	muxerWebRTC := webrtc.NewMuxer(webrtc.Options{
-		ICEServers:    h.cfg.GetICEServers(),
-		ICEUsername:   h.cfg.GetICEUsername(),
-		ICECredential: h.cfg.GetICECredential(),
-		PortMin:       h.cfg.GetWebRTCPortMin(),
-		PortMax:       h.cfg.GetWebRTCPortMax(),
-	})
+	muxerWebRTC := webrtc.NewMuxer(h.webrtcUseCase.MuxerOptions(streamID, middleware.Actor(c)))
 
 	answer, err := muxerWebRTC.WriteHeader(codecs, sdp64)
+	if errors.Is(err, webrtc.ErrorClientCodecUnsupported) {
+		log.Printf("[HandleWebRTCWithUUID] Stream %s: %v", streamID, err)
+		release()
+		c.String(http.StatusNotAcceptable, err.Error())
+		return
+	}
 	if err != nil {
 		log.Printf("[HandleWebRTCWithUUID] WriteHeader error: %v", err)
+		release()
 		return
 	}
 
@@ -120,10 +155,15 @@ func (h *WebRTCHandler) HandleWebRTCWithUUID(c *gin.Context) {
 	_, err = c.Writer.Write([]byte(answer))
 	if err != nil {
 		log.Printf("[HandleWebRTCWithUUID] Write error: %v", err)
+		muxerWebRTC.Close()
+		release()
 		return
 	}
 
-	go h.handleStreamConnection(streamID, muxerWebRTC, AudioOnly)
+	go func() {
+		defer release()
+		h.handleStreamConnection(streamID, muxerWebRTC, AudioOnly)
+	}()
 }
 
 // HandleWebRTC processes WebRTC connections with URL
@@ -131,7 +171,19 @@ func (h *WebRTCHandler) HandleWebRTC(c *gin.Context) {
 	url := c.PostForm("url")
 	sdp64 := c.PostForm("sdp64")
 
-	response, err := h.webrtcUseCase.HandleWebRTC(url, sdp64)
+	response, err := h.webrtcUseCase.HandleWebRTC(middleware.Actor(c), url, sdp64)
+	if errors.Is(err, usecase.ErrTooManyPeerConnections) {
+		middleware.AbortTooManyRequests(c, peerConnectionRetryAfter)
+		return
+	}
+	if errors.Is(err, usecase.ErrClientCannotPlay) {
+		c.JSON(http.StatusNotAcceptable, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, usecase.ErrURLPlaybackDisabled) || errors.Is(err, usecase.ErrSourceNotAllowed) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -142,12 +194,13 @@ func (h *WebRTCHandler) HandleWebRTC(c *gin.Context) {
 
 // handleStreamConnection manages the WebRTC stream connection
 func (h *WebRTCHandler) handleStreamConnection(streamID string, muxerWebRTC *webrtc.Muxer, AudioOnly bool) {
-	viewerID, packetChannel := h.cfg.AddViewer(streamID)
+	viewerID, packetChannel := h.cfg.AddViewer(streamID, muxerWebRTC)
 	defer h.cfg.RemoveViewer(streamID, viewerID)
 	defer muxerWebRTC.Close()
 
 	var videoStart bool
-	noVideo := time.NewTimer(10 * time.Second)
+	noVideoTimeout := h.cfg.GetWorker().ViewerNoVideoTimeout.Duration()
+	noVideo := time.NewTimer(noVideoTimeout)
 	defer noVideo.Stop()
 
 	for {
@@ -155,9 +208,17 @@ func (h *WebRTCHandler) handleStreamConnection(streamID string, muxerWebRTC *web
 		case <-noVideo.C:
 			log.Printf("[handleStreamConnection] No video timeout for stream %s", streamID)
 			return
+		case <-muxerWebRTC.KeyframeRequests():
+			if !videoStart {
+				continue
+			}
+			if err := muxerWebRTC.WriteReplay(h.cfg.ReplayGOP(streamID, viewerID)); err != nil {
+				log.Printf("[handleStreamConnection] WriteReplay error for stream %s: %v", streamID, err)
+				return
+			}
 		case packet := <-packetChannel:
 			if packet.IsKeyFrame || AudioOnly {
-				noVideo.Reset(10 * time.Second)
+				noVideo.Reset(noVideoTimeout)
 				videoStart = true
 			}
 			if !videoStart && !AudioOnly {
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/pkg/auth"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/gin-gonic/gin"
+)
+
+// TokenQuery carries the bearer token where no header can be set, as on
+// browser WebSocket upgrades
+const TokenQuery = "access_token"
+
+const (
+	anonymousActor = "anonymous"
+	actorKey       = "actor"
+)
+
+// Authenticate resolves who performs each request: the common name of a
+// verified TLS client certificate, or the name in a bearer token signed with
+// server.auth.token_secret. Requests with neither are anonymous. An invalid
+// or expired token is rejected with 401 and passed to onFailure.
+func Authenticate(onFailure func(actor models.Actor, err error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := models.Actor{Name: anonymousActor, IP: c.ClientIP()}
+		if name := clientCertificateName(c.Request); name != "" {
+			actor.Name, actor.Authenticated = name, true
+		} else if token := bearerToken(c); token != "" {
+			name, err := auth.Verify(config.GetInstance().GetAuth().TokenSecret, token, time.Now())
+			if err != nil {
+				onFailure(actor, err)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			actor.Name, actor.Authenticated = name, true
+		}
+		c.Set(actorKey, actor)
+		c.Next()
+	}
+}
+
+// RequireAuth rejects anonymous requests with 401
+func RequireAuth(c *gin.Context) {
+	if !Actor(c).Authenticated {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "authentication required"})
+		return
+	}
+	c.Next()
+}
+
+// Actor returns the identity and source address of the current request
+func Actor(c *gin.Context) models.Actor {
+	if value, ok := c.Get(actorKey); ok {
+		return value.(models.Actor)
+	}
+	return models.Actor{Name: anonymousActor, IP: c.ClientIP()}
+}
+
+// clientCertificateName returns the common name of a client certificate
+// that was verified against server.tls.client_ca_file
+func clientCertificateName(req *http.Request) string {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return req.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+func bearerToken(c *gin.Context) string {
+	if scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	return c.Query(TokenQuery)
+}
@@ -1,23 +1,174 @@
 package middleware
 
 import (
-	"github.com/gin-gonic/gin"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/gin-gonic/gin"
 )
 
-func CORSMiddleware() gin.HandlerFunc {
+// CORSMiddleware applies the configured CORS policy. Same-origin requests
+// always pass. Preflight requests are answered directly. Requests from
+// disallowed origins are rejected when browsers would send them without a
+// preflight and act on them anyway: unsafe methods such as a form POST, and
+// WebSocket and SSE requests, on which browsers do not enforce CORS.
+func CORSMiddleware(cfg config.CORSConfig) gin.HandlerFunc {
+	policy := newCORSPolicy(cfg)
+
 	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Allow-Headers", "Origin, X-Requested-With, Content-Type, Accept, Authorization, x-access-token")
-		c.Header("Access-Control-Expose-Headers", "Content-Length, Access-Control-Allow-Origin, Access-Control-Allow-Headers, Cache-Control, Content-Language, Content-Type")
-		c.Header("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusNoContent)
+		origin := c.GetHeader("Origin")
+		if origin == "" || sameOrigin(c.Request, origin) {
+			c.Next()
+			return
+		}
+
+		c.Writer.Header().Add("Vary", "Origin")
+		allowed := policy.AllowOrigin(origin)
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !allowed {
+			if preflight || !isSafeMethod(c.Request.Method) || isStreamingUpgrade(c.Request) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Origin not allowed"})
+				return
+			}
+			c.Next()
 			return
 		}
 
-		c.Next()
+		// Credentials are never combined with the "*" wildcard
+		if policy.wildcard {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+			if cfg.AllowCredentials {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			if len(cfg.ExposedHeaders) > 0 {
+				c.Header("Access-Control-Expose-Headers", strings.Join(cfg.ExposedHeaders, ", "))
+			}
+			c.Next()
+			return
+		}
+
+		method := c.GetHeader("Access-Control-Request-Method")
+		if !policy.methods[strings.ToUpper(method)] {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Method not allowed"})
+			return
+		}
+		for _, header := range strings.Split(c.GetHeader("Access-Control-Request-Headers"), ",") {
+			header = strings.TrimSpace(header)
+			if header != "" && !policy.headers[strings.ToLower(header)] {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Header not allowed: " + header})
+				return
+			}
+		}
+
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Method")
+		c.Writer.Header().Add("Vary", "Access-Control-Request-Headers")
+		c.Header("Access-Control-Allow-Methods", strings.Join(cfg.AllowedMethods, ", "))
+		c.Header("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+		if cfg.MaxAge > 0 {
+			c.Header("Access-Control-Max-Age", strconv.Itoa(int(cfg.MaxAge.Duration().Seconds())))
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
+
+// CheckOrigin reports whether the request's Origin is allowed by cfg. It is
+// meant for WebSocket upgraders; requests without an Origin or from the
+// same origin are accepted. With no allowed origins it returns nil so the
+// upgrader falls back to its own same-origin check.
+func CheckOrigin(cfg config.CORSConfig) func(r *http.Request) bool {
+	if len(cfg.AllowedOrigins) == 0 {
+		return nil
+	}
+	policy := newCORSPolicy(cfg)
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		return origin == "" || sameOrigin(r, origin) || policy.AllowOrigin(origin)
+	}
+}
+
+type corsPolicy struct {
+	wildcard bool
+	exact    map[string]bool
+	suffixes []originPattern
+	methods  map[string]bool
+	headers  map[string]bool
+}
+
+// originPattern matches "scheme://*.domain" origins
+type originPattern struct {
+	scheme string
+	suffix string
+}
+
+func newCORSPolicy(cfg config.CORSConfig) *corsPolicy {
+	p := &corsPolicy{
+		exact:   make(map[string]bool),
+		methods: make(map[string]bool),
+		headers: make(map[string]bool),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		switch {
+		case origin == "*":
+			p.wildcard = true
+		case strings.Contains(origin, "://*."):
+			parts := strings.SplitN(origin, "://*", 2)
+			p.suffixes = append(p.suffixes, originPattern{scheme: parts[0] + "://", suffix: parts[1]})
+		default:
+			p.exact[origin] = true
+		}
+	}
+	for _, method := range cfg.AllowedMethods {
+		p.methods[strings.ToUpper(method)] = true
+	}
+	for _, header := range cfg.AllowedHeaders {
+		p.headers[strings.ToLower(header)] = true
+	}
+	return p
+}
+
+func (p *corsPolicy) AllowOrigin(origin string) bool {
+	if p.wildcard {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.exact[origin] {
+		return true
+	}
+	for _, pattern := range p.suffixes {
+		if !strings.HasPrefix(origin, pattern.scheme) {
+			continue
+		}
+		host := strings.TrimPrefix(origin, pattern.scheme)
+		if strings.HasSuffix(host, pattern.suffix) && len(host) > len(pattern.suffix) {
+			return true
+		}
 	}
+	return false
+}
+
+// sameOrigin reports whether origin names the host the request was sent to
+func sameOrigin(r *http.Request, origin string) bool {
+	u, err := url.Parse(origin)
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// isSafeMethod reports whether the method only reads, so a cross-site
+// request cannot change anything and the browser withholds the response
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+func isStreamingUpgrade(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream")
 }
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestCORSMiddlewareRejectsDisallowedOrigins(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	engine.Use(CORSMiddleware(config.CORSConfig{
+		AllowedOrigins: []string{"https://console.example.com"},
+		AllowedMethods: []string{"GET", "POST"},
+		AllowedHeaders: []string{"Content-Type"},
+	}))
+	engine.Any("/api/streams", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		origin string
+		header map[string]string
+		want   int
+	}{
+		{"no origin", http.MethodPost, "", nil, http.StatusOK},
+		{"same origin post", http.MethodPost, "http://camera.local", nil, http.StatusOK},
+		{"allowed origin post", http.MethodPost, "https://console.example.com", nil, http.StatusOK},
+		{"cross-site form post", http.MethodPost, "https://evil.example", map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, http.StatusForbidden},
+		{"cross-site delete", http.MethodDelete, "https://evil.example", nil, http.StatusForbidden},
+		{"cross-site get", http.MethodGet, "https://evil.example", nil, http.StatusOK},
+		{"cross-site preflight", http.MethodOptions, "https://evil.example", map[string]string{"Access-Control-Request-Method": "POST"}, http.StatusForbidden},
+		{"cross-site websocket", http.MethodGet, "https://evil.example", map[string]string{"Upgrade": "websocket"}, http.StatusForbidden},
+		{"allowed preflight", http.MethodOptions, "https://console.example.com", map[string]string{"Access-Control-Request-Method": "POST"}, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "http://camera.local/api/streams", strings.NewReader("name=x"))
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			for key, value := range tt.header {
+				req.Header.Set(key, value)
+			}
+			rec := httptest.NewRecorder()
+			engine.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
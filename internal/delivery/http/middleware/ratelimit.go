@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/DaffaJatmiko/stream_camera/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimitMiddleware rejects requests exceeding the per-IP or per-principal
+// limits of rule with 429 Too Many Requests. The IP is the remote address
+// unless the request came through server.trusted_proxies, and principals
+// are verified identities; anonymous requests are limited by IP only.
+func RateLimitMiddleware(rule config.RateLimitRule) gin.HandlerFunc {
+	perIP := ratelimit.NewLimiter(rule.PerIP, rule.Burst)
+	perPrincipal := ratelimit.NewLimiter(rule.PerPrincipal, rule.Burst)
+
+	return func(c *gin.Context) {
+		actor := Actor(c)
+
+		if ok, wait := perIP.Allow(actor.IP); !ok {
+			AbortTooManyRequests(c, wait)
+			return
+		}
+		if actor.Authenticated {
+			if ok, wait := perPrincipal.Allow(actor.Name); !ok {
+				AbortTooManyRequests(c, wait)
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
+
+// AbortTooManyRequests responds 429 with a Retry-After header in whole seconds
+func AbortTooManyRequests(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests"})
+}
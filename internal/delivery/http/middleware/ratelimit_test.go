@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimitKeysOnRemoteAddress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		remoteAddr     string
+		wantIPs        []string // client address of each request
+		wantSecond     int
+	}{
+		{
+			name:       "spoofed forwarded for without trusted proxies",
+			remoteAddr: "198.51.100.7:40000",
+			wantIPs:    []string{"198.51.100.7", "198.51.100.7"},
+			wantSecond: http.StatusTooManyRequests,
+		},
+		{
+			name:           "spoofed forwarded for from an untrusted peer",
+			trustedProxies: []string{"10.0.0.1"},
+			remoteAddr:     "198.51.100.7:40000",
+			wantIPs:        []string{"198.51.100.7", "198.51.100.7"},
+			wantSecond:     http.StatusTooManyRequests,
+		},
+		{
+			name:           "clients behind a trusted proxy",
+			trustedProxies: []string{"10.0.0.0/8"},
+			remoteAddr:     "10.0.0.1:40000",
+			wantIPs:        []string{"203.0.113.1", "203.0.113.2"},
+			wantSecond:     http.StatusOK,
+		},
+	}
+	forwardedFor := []string{"203.0.113.1", "203.0.113.2"}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			engine := gin.New()
+			if err := engine.SetTrustedProxies(tt.trustedProxies); err != nil {
+				t.Fatalf("set trusted proxies: %v", err)
+			}
+			engine.Use(Authenticate(func(models.Actor, error) {}))
+			engine.GET("/ip", func(c *gin.Context) {
+				c.String(http.StatusOK, Actor(c).IP)
+			})
+			engine.GET("/limited", RateLimitMiddleware(config.RateLimitRule{PerIP: 1, Burst: 1}), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			serve := func(path string, i int) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, path, nil)
+				req.RemoteAddr = tt.remoteAddr
+				req.Header.Set("X-Forwarded-For", forwardedFor[i])
+				rec := httptest.NewRecorder()
+				engine.ServeHTTP(rec, req)
+				return rec
+			}
+
+			for i, want := range tt.wantIPs {
+				if got := serve("/ip", i).Body.String(); got != want {
+					t.Errorf("request %d: client address %s, want %s", i, got, want)
+				}
+			}
+			if rec := serve("/limited", 0); rec.Code != http.StatusOK {
+				t.Fatalf("first request: status %d, want %d", rec.Code, http.StatusOK)
+			}
+			if rec := serve("/limited", 1); rec.Code != tt.wantSecond {
+				t.Errorf("second request: status %d, want %d", rec.Code, tt.wantSecond)
+			}
+		})
+	}
+}
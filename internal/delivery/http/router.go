@@ -3,7 +3,9 @@ package http
 import (
 	"github.com/DaffaJatmiko/stream_camera/internal/delivery/http/handlers"
 	"github.com/DaffaJatmiko/stream_camera/internal/delivery/http/middleware"
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
 	"github.com/DaffaJatmiko/stream_camera/internal/usecase"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
 	"github.com/gin-gonic/gin"
 	"log"
 )
@@ -12,46 +14,84 @@ type Router struct {
 	engine        *gin.Engine
 	streamHandler *handlers.StreamHandler
 	webrtcHandler *handlers.WebRTCHandler
+	auditHandler  *handlers.AuditHandler
 }
 
-func NewRouter(streamUseCase usecase.StreamUseCase, webrtcUseCase usecase.WebRTCUseCase) *Router {
+func NewRouter(streamUseCase usecase.StreamUseCase, webrtcUseCase usecase.WebRTCUseCase, auditUseCase usecase.AuditUseCase) (*Router, error) {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.Default()
+	// Client addresses come from X-Forwarded-For only behind trusted proxies
+	if err := router.SetTrustedProxies(config.GetInstance().GetTrustedProxies()); err != nil {
+		return nil, err
+	}
 
 	// Add middlewares
-	router.Use(middleware.CORSMiddleware())
+	router.Use(middleware.CORSMiddleware(config.GetInstance().GetCORS()))
 	router.Use(gin.Logger())
+	router.Use(middleware.Authenticate(func(actor models.Actor, err error) {
+		auditUseCase.Record(actor, models.AuditActionAuthFailure, "auth", nil, map[string]string{"error": err.Error()})
+	}))
 
 	r := &Router{
 		engine:        router,
 		streamHandler: handlers.NewStreamHandler(streamUseCase),
 		webrtcHandler: handlers.NewWebRTCHandler(webrtcUseCase),
+		auditHandler:  handlers.NewAuditHandler(auditUseCase),
 	}
 
 	// Setup routes immediately
 	r.setupRoutes()
 
-	return r
+	return r, nil
 }
 
 func (r *Router) setupRoutes() {
+	limits := config.GetInstance().GetRateLimit()
+	signalingLimit := middleware.RateLimitMiddleware(limits.Signaling)
+	apiLimit := middleware.RateLimitMiddleware(limits.API)
+
 	// Existing routes
-	r.engine.GET("/streams", r.streamHandler.GetStreamList)
-	r.engine.POST("/stream", r.webrtcHandler.HandleWebRTC)
-	r.engine.POST("/stream/receiver/:uuid", r.webrtcHandler.HandleWebRTCWithUUID)
-	r.engine.GET("/stream/codec/:uuid", r.webrtcHandler.GetStreamCodec)
+	r.engine.GET("/streams", apiLimit, r.streamHandler.GetStreamList)
+
+	signaling := r.engine.Group("/stream", signalingLimit)
+	{
+		signaling.POST("", r.webrtcHandler.HandleWebRTC)
+		signaling.POST("/receiver/:uuid", r.webrtcHandler.HandleWebRTCWithUUID)
+		signaling.GET("/codec/:uuid", r.webrtcHandler.GetStreamCodec)
+		signaling.POST("/codec/:uuid", r.webrtcHandler.NegotiateStreamCodec)
+		signaling.GET("/ws/:uuid", r.webrtcHandler.HandleSignaling)
+		signaling.GET("/ice", r.webrtcHandler.GetICEServers)
+	}
 
-	api := r.engine.Group("/api")
+	// The management API changes streams and reads the audit log, so only
+	// authenticated operators may use it
+	api := r.engine.Group("/api", apiLimit, middleware.RequireAuth)
 	{
-		api.GET("/streams", r.streamHandler.GetStreamList)
+		api.GET("/streams", r.streamHandler.ListStreams)
 		api.GET("/streams/:uuid", r.streamHandler.GetStream)
+		api.GET("/streams/:uuid/stats", r.streamHandler.GetStreamStats)
+		api.GET("/streams/:uuid/viewers", r.streamHandler.GetViewerStats)
+		api.DELETE("/streams/:uuid/viewers/:viewer", r.streamHandler.KickViewer)
 		api.POST("/streams", r.streamHandler.CreateStream)
 		api.PUT("/streams/:uuid", r.streamHandler.UpdateStream)
 		api.DELETE("/streams/:uuid", r.streamHandler.DeleteStream)
+		api.GET("/streams/deleted", r.streamHandler.GetDeletedStreams)
+		api.GET("/streams/export", r.streamHandler.ExportStreams)
+		api.POST("/streams/import", r.streamHandler.ImportStreams)
+		api.POST("/streams/probe", r.streamHandler.ProbeStream)
+		api.POST("/streams/:uuid/restore", r.streamHandler.RestoreStream)
+		api.DELETE("/streams/:uuid/purge", r.streamHandler.PurgeStream)
+
+		api.GET("/turn/stats", r.webrtcHandler.GetTURNStats)
+
+		api.GET("/audit", r.auditHandler.GetAuditLog)
 	}
 }
 
 func (r *Router) Run(addr string) error {
+	if tlsConfig := config.GetInstance().GetTLS(); tlsConfig.Enabled() {
+		return r.runTLS(addr, tlsConfig)
+	}
 	log.Printf("Starting server on %s", addr)
 	return r.engine.Run(addr)
 }
@@ -0,0 +1,78 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
+	"github.com/DaffaJatmiko/stream_camera/internal/usecase"
+	"github.com/DaffaJatmiko/stream_camera/pkg/auth"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/DaffaJatmiko/stream_camera/pkg/database"
+)
+
+const testTokenSecret = "0123456789abcdef0123456789abcdef"
+
+func newTestRouter(t *testing.T) *Router {
+	t.Helper()
+	if _, err := config.Load([]string{"-env_file", "none", "-auth_token_secret", testTokenSecret}); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	db, err := database.New(config.DatabaseConfig{Driver: database.DriverMemory})
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	streamRepo := repository.NewStreamRepository(db.DB)
+	auditUseCase := usecase.NewAuditUseCase(repository.NewAuditRepository(db.DB))
+	router, err := NewRouter(
+		usecase.NewStreamUseCase(streamRepo, auditUseCase),
+		usecase.NewWebRTCUseCase(streamRepo, nil, nil),
+		auditUseCase,
+	)
+	if err != nil {
+		t.Fatalf("new router: %v", err)
+	}
+	return router
+}
+
+func TestAPIRequiresAuthentication(t *testing.T) {
+	router := newTestRouter(t)
+	token, err := auth.Issue(testTokenSecret, "alice", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("issue token: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"anonymous audit log", http.MethodGet, "/api/audit", "", http.StatusUnauthorized},
+		{"anonymous stream list", http.MethodGet, "/api/streams", "", http.StatusUnauthorized},
+		{"anonymous export", http.MethodGet, "/api/streams/export", "", http.StatusUnauthorized},
+		{"anonymous purge", http.MethodDelete, "/api/streams/some-uuid/purge", "", http.StatusUnauthorized},
+		{"anonymous kick", http.MethodDelete, "/api/streams/some-uuid/viewers/some-viewer", "", http.StatusUnauthorized},
+		{"anonymous turn stats", http.MethodGet, "/api/turn/stats", "", http.StatusUnauthorized},
+		{"invalid token", http.MethodGet, "/api/audit", "not-a-token", http.StatusUnauthorized},
+		{"authenticated audit log", http.MethodGet, "/api/audit", token, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			router.engine.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("%s %s: status %d, want %d", tt.method, tt.path, rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	nethttp "net/http"
+	"os"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/certreload"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+)
+
+// runTLS serves HTTPS on addr, reloading the certificate when it changes
+func (r *Router) runTLS(addr string, cfg config.TLSConfig) error {
+	reloader, err := certreload.New(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load tls certificate: %w", err)
+	}
+	defer reloader.Close()
+
+	tlsConfig, err := buildTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+	tlsConfig.GetCertificate = reloader.GetCertificate
+
+	if cfg.RedirectPort != "" {
+		go runHTTPSRedirect(cfg.RedirectPort, addr)
+	}
+
+	server := &nethttp.Server{
+		Addr:      addr,
+		Handler:   r.engine,
+		TLSConfig: tlsConfig,
+	}
+	log.Printf("Starting TLS server on %s", addr)
+	return server.ListenAndServeTLS("", "")
+}
+
+func buildTLSConfig(cfg config.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	switch cfg.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported tls min_version %q", cfg.MinVersion)
+	}
+
+	if cfg.ClientCAFile == "" {
+		if cfg.ClientAuth != "" {
+			return nil, fmt.Errorf("tls client_auth %q requires a client_ca_file to verify certificates against", cfg.ClientAuth)
+		}
+		return tlsConfig, nil
+	}
+	pem, err := os.ReadFile(cfg.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("read tls client_ca_file: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", cfg.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+
+	switch cfg.ClientAuth {
+	case "request":
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	case "", "require", "verify":
+		// Certificates are always verified against ClientCAs; an unverified
+		// certificate proves nothing about who connects
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unsupported tls client_auth %q", cfg.ClientAuth)
+	}
+	return tlsConfig, nil
+}
+
+// runHTTPSRedirect answers plain HTTP on addr with a permanent redirect to
+// the same host and path on the HTTPS listener.
+func runHTTPSRedirect(addr string, httpsAddr string) {
+	_, httpsPort, _ := net.SplitHostPort(httpsAddr)
+
+	handler := nethttp.HandlerFunc(func(w nethttp.ResponseWriter, req *nethttp.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = net.JoinHostPort(host, httpsPort)
+		}
+		target := "https://" + host + req.URL.RequestURI()
+		nethttp.Redirect(w, req, target, nethttp.StatusMovedPermanently)
+	})
+
+	log.Printf("Redirecting HTTP on %s to HTTPS", addr)
+	if err := nethttp.ListenAndServe(addr, handler); err != nil {
+		log.Printf("HTTP redirect listener stopped: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audit actions recorded by the usecases.
+const (
+	AuditActionStreamCreate  = "stream.create"
+	AuditActionStreamUpdate  = "stream.update"
+	AuditActionStreamDelete  = "stream.delete"
+	AuditActionStreamRestore = "stream.restore"
+	AuditActionStreamPurge   = "stream.purge"
+	AuditActionConfigReload  = "config.reload"
+	AuditActionConfigReject  = "config.reload_rejected"
+	AuditActionViewerKick    = "viewer.kick"
+	AuditActionAuthFailure   = "auth.failure"
+)
+
+// SystemActor is recorded for actions the server performs on its own
+var SystemActor = Actor{Name: "system"}
+
+// Actor identifies who performed an administrative action.
+type Actor struct {
+	Name string
+	IP   string
+	// Authenticated is set when Name was verified from a signed token or a
+	// client certificate; otherwise Name is "anonymous"
+	Authenticated bool
+}
+
+type AuditLog struct {
+	ID        uint      `gorm:"primarykey"`
+	CreatedAt time.Time `gorm:"index"`
+	Actor     string    `gorm:"index"`
+	SourceIP  string
+	Action    string `gorm:"index"`
+	Resource  string `gorm:"index"`
+	Before    string `gorm:"type:text"`
+	After     string `gorm:"type:text"`
+	Changes   string `gorm:"type:text"`
+}
+
+type AuditLogResponse struct {
+	ID        uint            `json:"id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Actor     string          `json:"actor"`
+	SourceIP  string          `json:"source_ip"`
+	Action    string          `json:"action"`
+	Resource  string          `json:"resource"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	Changes   json.RawMessage `json:"changes,omitempty"`
+}
+
+// AuditFilter narrows down an audit log query. Zero values are ignored.
+type AuditFilter struct {
+	Actor    string
+	SourceIP string
+	Action   string
+	Resource string
+	From     time.Time
+	To       time.Time
+	Page     int
+	PageSize int
+}
+
+type AuditLogPage struct {
+	Items    []AuditLogResponse `json:"items"`
+	Total    int64              `json:"total"`
+	Page     int                `json:"page"`
+	PageSize int                `json:"page_size"`
+}
@@ -0,0 +1,47 @@
+package models
+
+// Playback transports a client can be pointed at
+const (
+	TransportWebRTC = "webrtc"
+)
+
+// CodecDescriptor describes the codec of one media track
+type CodecDescriptor struct {
+	Type  string `json:"type"` // "video" or "audio"
+	Codec string `json:"codec"`
+	// Video
+	Width          int    `json:"width,omitempty"`
+	Height         int    `json:"height,omitempty"`
+	FPS            int    `json:"fps,omitempty"`
+	Profile        string `json:"profile,omitempty"`
+	Level          string `json:"level,omitempty"`
+	ProfileLevelID string `json:"profile_level_id,omitempty"` // H264 SDP fmtp value
+	// Audio
+	SampleRate int `json:"sample_rate,omitempty"`
+	Channels   int `json:"channels,omitempty"`
+}
+
+// CodecNegotiationRequest lists what a client can play, either as codec
+// names (e.g. "H264", "video/H265", "opus") or as a base64 SDP offer
+type CodecNegotiationRequest struct {
+	Codecs []string `json:"codecs"`
+	Sdp64  string   `json:"sdp64"`
+}
+
+// NegotiatedTrack is a track delivered to viewers and whether the client
+// can play it
+type NegotiatedTrack struct {
+	CodecDescriptor
+	Playable bool `json:"playable"`
+}
+
+// CodecNegotiation is the outcome of matching a stream against a client
+type CodecNegotiation struct {
+	Tracks []NegotiatedTrack `json:"tracks"`
+	// Playable lists the codecs of the tracks the client can play
+	Playable []string `json:"playable"`
+	// Transport is the recommended transport, empty when none can play
+	// the stream and Reason says why
+	Transport string `json:"transport,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
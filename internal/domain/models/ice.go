@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// ICEServer is an ICE server in the browser's RTCIceServer form
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
+// ICEServers are the ICE servers a client should configure its peer
+// connection with. ExpiresAt is set when they include TURN credentials.
+type ICEServers struct {
+	ICEServers []ICEServer `json:"ice_servers"`
+	ExpiresAt  *time.Time  `json:"expires_at,omitempty"`
+}
+
+// TURNStats describes the use of the embedded TURN server
+type TURNStats struct {
+	Allocations int    `json:"allocations"`
+	AuthOK      uint64 `json:"auth_ok"`
+	AuthFailed  uint64 `json:"auth_failed"`
+	PeersDenied uint64 `json:"peers_denied"`
+}
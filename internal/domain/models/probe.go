@@ -0,0 +1,43 @@
+package models
+
+// StreamProbeRequest asks for a test connection to an RTSP source.
+// Username and Password replace any user info in the URL.
+type StreamProbeRequest struct {
+	URL            string `json:"url" binding:"required"`
+	Username       string `json:"username,omitempty"`
+	Password       string `json:"password,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+}
+
+// Stream probe authentication outcomes
+const (
+	ProbeAuthOK           = "ok"
+	ProbeAuthFailed       = "failed"
+	ProbeAuthNotAttempted = "not_attempted" // the source could not be reached
+	ProbeAuthUnknown      = "unknown"       // the source failed before authentication was checked
+)
+
+// StreamProbeResult is the outcome of a probe
+type StreamProbeResult struct {
+	Reachable bool   `json:"reachable"`
+	Auth      string `json:"auth"`
+	Error     string `json:"error,omitempty"`
+	// WebRTCCompatible is set when the video track, or for audio-only
+	// sources an audio track, can be delivered to WebRTC viewers
+	WebRTCCompatible bool         `json:"webrtc_compatible"`
+	Tracks           []ProbeTrack `json:"tracks"`
+	DurationMs       int64        `json:"duration_ms"`
+}
+
+// Passed reports whether the source is usable for WebRTC playback
+func (r *StreamProbeResult) Passed() bool {
+	return r.Reachable && r.Auth == ProbeAuthOK && r.WebRTCCompatible
+}
+
+// ProbeTrack describes one media track found by a probe
+type ProbeTrack struct {
+	CodecDescriptor
+	WebRTC bool `json:"webrtc"`
+	// Transcodable is set for audio that audio_transcode can convert
+	Transcodable bool `json:"transcodable,omitempty"`
+}
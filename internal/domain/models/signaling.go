@@ -0,0 +1,42 @@
+package models
+
+// Signaling message types exchanged over the /stream/ws WebSocket
+const (
+	// SignalOffer from the client starts a session, or restarts ICE on
+	// the current one. Sdp64 holds the base64 offer.
+	SignalOffer = "offer"
+	// SignalAnswer from the server answers an offer
+	SignalAnswer = "answer"
+	// SignalCandidate carries a trickled candidate in either direction; a
+	// message without Candidate ends the sender's gathering
+	SignalCandidate = "candidate"
+	// SignalResume from the client reattaches the session of a dropped
+	// WebSocket; it must be followed by an ICE restart offer
+	SignalResume = "resume"
+	// SignalSession from the server names the session to resume
+	SignalSession = "session"
+	// SignalClosed from the server ends the session
+	SignalClosed = "closed"
+	// SignalError from the server rejects the last message
+	SignalError = "error"
+)
+
+// SignalMessage is one message of the signaling WebSocket
+type SignalMessage struct {
+	Type      string        `json:"type"`
+	Session   string        `json:"session,omitempty"`
+	Sdp64     string        `json:"sdp64,omitempty"`
+	Candidate *ICECandidate `json:"candidate,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	// ResumeToken is the secret a session is resumed with. The server sends
+	// a new one with every session message.
+	ResumeToken string `json:"resume_token,omitempty"`
+}
+
+// ICECandidate is an ICE candidate in the browser's RTCIceCandidateInit form
+type ICECandidate struct {
+	Candidate        string  `json:"candidate"`
+	SDPMid           *string `json:"sdpMid,omitempty"`
+	SDPMLineIndex    *uint16 `json:"sdpMLineIndex,omitempty"`
+	UsernameFragment *string `json:"usernameFragment,omitempty"`
+}
@@ -0,0 +1,88 @@
+package models
+
+import "time"
+
+// StreamStats is the runtime state of a stream
+type StreamStats struct {
+	UUID    string `json:"uuid"`
+	Online  bool   `json:"online"`
+	Viewers int    `json:"viewers"`
+	// RelayedViewers are connected through a TURN relay
+	RelayedViewers int      `json:"relayed_viewers"`
+	Codecs         []string `json:"codecs"` // codecs sent to viewers, in track order
+	// Transcode is set when the stream has an audio transcode target
+	Transcode *TranscodeStats `json:"transcode,omitempty"`
+	// KeyframeRequests counts the PLI/FIR sent by WebRTC viewers
+	KeyframeRequests KeyframeRequestStats `json:"keyframe_requests"`
+	// Quality summarises the connections of the WebRTC viewers
+	Quality ViewerQuality `json:"quality"`
+}
+
+// ViewerQuality aggregates the connection quality of a stream's viewers
+type ViewerQuality struct {
+	Viewers     int     `json:"viewers"` // viewers with a connection to measure
+	AvgRTTMs    float64 `json:"avg_rtt_ms"`
+	MaxRTTMs    float64 `json:"max_rtt_ms"`
+	MaxJitterMs float64 `json:"max_jitter_ms"`
+	PacketsSent uint64  `json:"packets_sent"`
+	PacketsLost int64   `json:"packets_lost"`
+	// LossRate is PacketsLost as a share of PacketsSent
+	LossRate    float64 `json:"loss_rate"`
+	NACKs       uint64  `json:"nack_count"`
+	PLIs        uint64  `json:"pli_count"`
+	BitrateKbps float64 `json:"bitrate_kbps"` // total outgoing
+	// Connections counts viewers by how they connect: "host", "srflx",
+	// "prflx" or "relay", whichever end of the candidate pair is indirect
+	Connections map[string]int `json:"connections"`
+}
+
+// ViewerStats is the connection quality of one WebRTC viewer
+type ViewerStats struct {
+	ID            string         `json:"id"`
+	Connected     *time.Time     `json:"connected,omitempty"`
+	CandidatePair *CandidatePair `json:"candidate_pair,omitempty"` // nil until ICE connects
+	RTTMs         float64        `json:"rtt_ms"`
+	JitterMs      float64        `json:"jitter_ms"`
+	PacketsSent   uint64         `json:"packets_sent"`
+	PacketsLost   int64          `json:"packets_lost"`
+	// FractionLost is the share lost in the viewer's last report interval
+	FractionLost float64 `json:"fraction_lost"`
+	NACKs        uint32  `json:"nack_count"`
+	PLIs         uint32  `json:"pli_count"`
+	FIRs         uint32  `json:"fir_count"`
+	BitrateKbps  float64 `json:"bitrate_kbps"`
+}
+
+// CandidatePair is the ICE candidate pair a viewer's media flows over
+type CandidatePair struct {
+	Local    string `json:"local"`  // candidate type: host, srflx, prflx or relay
+	Remote   string `json:"remote"` // candidate type of the viewer
+	Protocol string `json:"protocol"`
+	// Type is "relay", "srflx" or "prflx" when either end is, otherwise "host"
+	Type string `json:"type"`
+}
+
+// KeyframeRequestStats counts keyframe requests from viewers. Requests from
+// any viewer within a second of the last one are coalesced into it. Replays
+// counts the cached GOPs sent to viewers in answer.
+type KeyframeRequestStats struct {
+	Received  uint64     `json:"received"`
+	Coalesced uint64     `json:"coalesced"`
+	Replays   uint64     `json:"replays"`
+	Last      *time.Time `json:"last,omitempty"`
+}
+
+// TranscodeStats describes the audio transcoder of a stream's worker
+type TranscodeStats struct {
+	Target     string     `json:"target"`
+	Active     bool       `json:"active"`
+	Error      string     `json:"error,omitempty"` // why no transcoder is running
+	Source     string     `json:"source_codec,omitempty"`
+	FramesIn   uint64     `json:"frames_in"`
+	FramesOut  uint64     `json:"frames_out"`
+	Errors     uint64     `json:"errors"`
+	LastError  string     `json:"last_error,omitempty"`
+	CPUTimeMs  float64    `json:"cpu_time_ms"`
+	CPUPercent float64    `json:"cpu_percent"` // share of one core since Started
+	Started    *time.Time `json:"started,omitempty"`
+}
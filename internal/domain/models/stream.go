@@ -1,20 +1,112 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type Stream struct {
 	gorm.Model
-	UUID     string `json:"uuid"`
-	URL      string `json:"url"`
-	OnDemand bool   `json:"on_demand" gorm:"default:false"`
-	Debug    bool   `json:"debug" gorm:"default:false"`
+	UUID string `json:"uuid" gorm:"uniqueIndex:idx_streams_uuid,where:deleted_at IS NULL"`
+	// Name is an optional stable slug, unique among streams that are not deleted
+	Name        *string    `json:"name,omitempty" gorm:"uniqueIndex:idx_streams_name,where:deleted_at IS NULL"`
+	DisplayName string     `json:"display_name" gorm:"index"`
+	Description string     `json:"description"`
+	Site        string     `json:"site" gorm:"index"`
+	Group       string     `json:"group" gorm:"column:group_name;index"`
+	Latitude    *float64   `json:"latitude,omitempty"`
+	Longitude   *float64   `json:"longitude,omitempty"`
+	Tags        StringList `json:"tags" gorm:"type:text"`
+	Metadata    JSONMap    `json:"metadata,omitempty" gorm:"type:text"`
+	URL         string     `json:"url" gorm:"index"`
+	OnDemand    bool       `json:"on_demand" gorm:"default:false;index"`
+	Debug       bool       `json:"debug" gorm:"default:false"`
+	// DisableAudio pulls only the video track from the source
+	DisableAudio bool `json:"disable_audio" gorm:"default:false"`
+	// AudioTranscode converts source audio WebRTC cannot carry to "opus",
+	// "pcma" or "pcmu"; empty drops it
+	AudioTranscode string `json:"audio_transcode"`
+	// Backchannel lets operators talk to the camera over the RTSP audio
+	// backchannel
+	Backchannel bool `json:"backchannel" gorm:"default:false"`
+	// Ephemeral streams are created by ad-hoc URL playback and removed once idle
+	Ephemeral bool `json:"ephemeral" gorm:"default:false;index"`
+}
+
+// StreamRequest holds the fields clients may set when creating or updating a
+// stream. Identifiers, timestamps and the ephemeral flag are managed by the
+// server.
+type StreamRequest struct {
+	Name           *string    `json:"name,omitempty"`
+	DisplayName    string     `json:"display_name"`
+	Description    string     `json:"description"`
+	Site           string     `json:"site"`
+	Group          string     `json:"group"`
+	Latitude       *float64   `json:"latitude,omitempty"`
+	Longitude      *float64   `json:"longitude,omitempty"`
+	Tags           StringList `json:"tags"`
+	Metadata       JSONMap    `json:"metadata,omitempty"`
+	URL            string     `json:"url"`
+	OnDemand       bool       `json:"on_demand"`
+	Debug          bool       `json:"debug"`
+	DisableAudio   bool       `json:"disable_audio"`
+	AudioTranscode string     `json:"audio_transcode"`
+	Backchannel    bool       `json:"backchannel"`
 }
 
 type StreamResponse struct {
-	UUID     string `json:"uuid"`
-	URL      string `json:"url"`
-	OnDemand bool   `json:"on_demand"`
-	Debug    bool   `json:"debug"`
+	UUID           string     `json:"uuid"`
+	Name           *string    `json:"name,omitempty"`
+	DisplayName    string     `json:"display_name"`
+	Description    string     `json:"description,omitempty"`
+	Site           string     `json:"site,omitempty"`
+	Group          string     `json:"group,omitempty"`
+	Latitude       *float64   `json:"latitude,omitempty"`
+	Longitude      *float64   `json:"longitude,omitempty"`
+	Tags           StringList `json:"tags"`
+	Metadata       JSONMap    `json:"metadata,omitempty"`
+	URL            string     `json:"url"`
+	OnDemand       bool       `json:"on_demand"`
+	Debug          bool       `json:"debug"`
+	DisableAudio   bool       `json:"disable_audio"`
+	AudioTranscode string     `json:"audio_transcode,omitempty"`
+	Backchannel    bool       `json:"backchannel"`
+	Ephemeral      bool       `json:"ephemeral"`
+	Live           bool       `json:"live"`
+	DeletedAt      *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Stream listing sort keys
+const (
+	StreamSortCreated     = "created"
+	StreamSortName        = "name"
+	StreamSortDisplayName = "display_name"
+	StreamSortSite        = "site"
+	StreamSortGroup       = "group"
+)
+
+// StreamFilter narrows down and pages a stream listing. Zero values are ignored.
+type StreamFilter struct {
+	Tags     []string // every tag must be present
+	Site     string
+	Group    string
+	OnDemand *bool
+	Search   string // case-insensitive match on name, display name, description and site
+	// Live keeps only streams whose UUID is (or is not) in LiveUUIDs
+	Live      *bool
+	LiveUUIDs []string
+
+	Sort   string // one of the StreamSort keys, StreamSortCreated by default
+	Desc   bool
+	Cursor string // NextCursor of the previous page
+	Limit  int    // 0 returns every matching stream
+}
+
+// StreamPage is one page of a stream listing
+type StreamPage struct {
+	Items      []StreamResponse `json:"items"`
+	Total      int64            `json:"total"`
+	Limit      int              `json:"limit"`
+	NextCursor string           `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,71 @@
+package models
+
+import "time"
+
+// StreamInventoryVersion is the version of the export format
+const StreamInventoryVersion = 1
+
+// StreamRecord is the portable form of a stream used by bulk import and
+// export. Credentials holds the URL's user info, encrypted, and is only set
+// when the export includes credentials.
+type StreamRecord struct {
+	Name           string     `json:"name,omitempty"`
+	DisplayName    string     `json:"display_name,omitempty"`
+	Description    string     `json:"description,omitempty"`
+	Site           string     `json:"site,omitempty"`
+	Group          string     `json:"group,omitempty"`
+	Latitude       *float64   `json:"latitude,omitempty"`
+	Longitude      *float64   `json:"longitude,omitempty"`
+	Tags           StringList `json:"tags,omitempty"`
+	Metadata       JSONMap    `json:"metadata,omitempty"`
+	URL            string     `json:"url"`
+	OnDemand       bool       `json:"on_demand"`
+	Debug          bool       `json:"debug"`
+	DisableAudio   bool       `json:"disable_audio"`
+	AudioTranscode string     `json:"audio_transcode,omitempty"`
+	Backchannel    bool       `json:"backchannel,omitempty"`
+	Credentials    string     `json:"credentials,omitempty"`
+}
+
+// StreamInventory is a full export of the stream inventory
+type StreamInventory struct {
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	Streams    []StreamRecord `json:"streams"`
+}
+
+// StreamImportOptions controls a bulk import
+type StreamImportOptions struct {
+	DryRun bool // validate only, write nothing
+	Upsert bool // update streams whose name already exists instead of failing
+	// Passphrase decrypts credentials, the configured credential key is used when empty
+	Passphrase string
+}
+
+// Stream import row statuses. In a dry run they tell what would happen.
+const (
+	StreamImportCreated = "created"
+	StreamImportUpdated = "updated"
+	StreamImportSkipped = "skipped"
+	StreamImportFailed  = "failed"
+)
+
+// StreamImportResult is the outcome of one imported record
+type StreamImportResult struct {
+	Row    int    `json:"row"`
+	Name   string `json:"name,omitempty"`
+	UUID   string `json:"uuid,omitempty"`
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"` // why the record was skipped
+	Error  string `json:"error,omitempty"`
+}
+
+// StreamImportReport summarizes a bulk import
+type StreamImportReport struct {
+	DryRun  bool                 `json:"dry_run"`
+	Created int                  `json:"created"`
+	Updated int                  `json:"updated"`
+	Skipped int                  `json:"skipped"`
+	Failed  int                  `json:"failed"`
+	Rows    []StreamImportResult `json:"rows"`
+}
@@ -0,0 +1,108 @@
+package repository_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
+	"github.com/DaffaJatmiko/stream_camera/internal/repository/repositorytest"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/DaffaJatmiko/stream_camera/pkg/database"
+	"github.com/DaffaJatmiko/stream_camera/pkg/utils"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// postgresDSNEnv names the variable holding a PostgreSQL DSN to run the
+// suites against; they are skipped for postgres when it is unset
+const postgresDSNEnv = "STREAM_CAMERA_TEST_POSTGRES_DSN"
+
+// newDatabase returns a migrated, empty database of the given driver that
+// is closed when the test ends
+type newDatabase func(t *testing.T) *gorm.DB
+
+func TestStreamRepository(t *testing.T) {
+	for driver, open := range drivers() {
+		t.Run(driver, func(t *testing.T) {
+			repositorytest.RunStreamRepository(t, func(t *testing.T) repository.StreamRepository {
+				return repository.NewStreamRepository(open(t))
+			})
+		})
+	}
+}
+
+func TestAuditRepository(t *testing.T) {
+	for driver, open := range drivers() {
+		t.Run(driver, func(t *testing.T) {
+			repositorytest.RunAuditRepository(t, func(t *testing.T) repository.AuditRepository {
+				return repository.NewAuditRepository(open(t))
+			})
+		})
+	}
+}
+
+func drivers() map[string]newDatabase {
+	return map[string]newDatabase{
+		database.DriverMemory: func(t *testing.T) *gorm.DB {
+			return openDatabase(t, config.DatabaseConfig{Driver: database.DriverMemory})
+		},
+		database.DriverSQLite: func(t *testing.T) *gorm.DB {
+			path := filepath.Join(t.TempDir(), "stream_camera.db")
+			return openDatabase(t, config.DatabaseConfig{Driver: database.DriverSQLite, Path: path, AutoMigrate: true})
+		},
+		database.DriverPostgres: openPostgres,
+	}
+}
+
+func openDatabase(t *testing.T, cfg config.DatabaseConfig) *gorm.DB {
+	t.Helper()
+	db, err := database.New(cfg)
+	if err != nil {
+		t.Fatalf("open %s database: %v", cfg.Driver, err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db.DB
+}
+
+// openPostgres migrates a schema of its own inside the configured database
+// and drops it when the test ends
+func openPostgres(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv(postgresDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s is not set", postgresDSNEnv)
+	}
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open postgres: %v", err)
+	}
+	schema := "test_" + strings.ToLower(strings.ReplaceAll(utils.GenerateUUID(), "-", ""))
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	conn, err := gorm.Open(postgres.Open(dsn+" search_path="+schema), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("open postgres schema %s: %v", schema, err)
+	}
+	db := &database.Database{DB: conn, Driver: database.DriverPostgres}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := db.NewMigrator()
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return db.DB
+}
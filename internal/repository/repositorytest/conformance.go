@@ -0,0 +1,326 @@
+// Package repositorytest holds the conformance suite every repository
+// backend must pass. Backends call the Run functions from their tests with
+// a factory returning a repository on an empty, migrated database.
+package repositorytest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
+)
+
+// StreamRepositoryFactory returns a StreamRepository on an empty database
+type StreamRepositoryFactory func(t *testing.T) repository.StreamRepository
+
+// AuditRepositoryFactory returns an AuditRepository on an empty database
+type AuditRepositoryFactory func(t *testing.T) repository.AuditRepository
+
+// RunStreamRepository runs the stream repository conformance suite
+func RunStreamRepository(t *testing.T, newRepo StreamRepositoryFactory) {
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := newRepo(t)
+		stream := &models.Stream{UUID: "a", URL: "rtsp://camera/a", OnDemand: true}
+		mustNoError(t, repo.Create(stream))
+		if stream.ID == 0 {
+			t.Fatalf("Create did not assign an ID")
+		}
+
+		got, err := repo.GetByUUID("a")
+		mustNoError(t, err)
+		if got.URL != stream.URL || !got.OnDemand {
+			t.Fatalf("GetByUUID = %+v, want %+v", got, stream)
+		}
+
+		got, err = repo.GetByURL("rtsp://camera/a")
+		mustNoError(t, err)
+		if got.UUID != "a" {
+			t.Fatalf("GetByURL returned %q, want %q", got.UUID, "a")
+		}
+	})
+
+	t.Run("MissingStream", func(t *testing.T) {
+		repo := newRepo(t)
+		if _, err := repo.GetByUUID("missing"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("GetByUUID of a missing stream = %v, want ErrNotFound", err)
+		}
+		if _, err := repo.GetByURL("rtsp://missing"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("GetByURL of a missing stream = %v, want ErrNotFound", err)
+		}
+		if _, err := repo.GetByName("missing"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("GetByName of a missing stream = %v, want ErrNotFound", err)
+		}
+		if err := repo.Delete("missing"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Delete of a missing stream = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("Uniqueness", func(t *testing.T) {
+		repo := newRepo(t)
+		name := "gate"
+		mustNoError(t, repo.Create(&models.Stream{UUID: "a", Name: &name, URL: "rtsp://camera/a"}))
+		got, err := repo.GetByName(name)
+		mustNoError(t, err)
+		if got.UUID != "a" {
+			t.Fatalf("GetByName returned %q, want %q", got.UUID, "a")
+		}
+
+		if err := repo.Create(&models.Stream{UUID: "a", URL: "rtsp://camera/b"}); !errors.Is(err, repository.ErrConflict) {
+			t.Fatalf("Create with a duplicate UUID = %v, want ErrConflict", err)
+		}
+		if err := repo.Create(&models.Stream{UUID: "b", Name: &name, URL: "rtsp://camera/b"}); !errors.Is(err, repository.ErrConflict) {
+			t.Fatalf("Create with a duplicate name = %v, want ErrConflict", err)
+		}
+		mustNoError(t, repo.Create(&models.Stream{UUID: "c", URL: "rtsp://camera/c"}))
+		mustNoError(t, repo.Create(&models.Stream{UUID: "d", URL: "rtsp://camera/c"}))
+	})
+
+	t.Run("RestoreAndPurge", func(t *testing.T) {
+		repo := newRepo(t)
+		name := "gate"
+		mustNoError(t, repo.Create(&models.Stream{UUID: "a", Name: &name, URL: "rtsp://camera/a"}))
+		mustNoError(t, repo.Delete("a"))
+
+		// A deleted stream no longer blocks its name
+		mustNoError(t, repo.Create(&models.Stream{UUID: "b", Name: &name, URL: "rtsp://camera/b"}))
+		if err := repo.Restore("a"); !errors.Is(err, repository.ErrConflict) {
+			t.Fatalf("Restore over a live name = %v, want ErrConflict", err)
+		}
+
+		mustNoError(t, repo.Delete("b"))
+		mustNoError(t, repo.Restore("a"))
+		if _, err := repo.GetByUUID("a"); err != nil {
+			t.Fatalf("restored stream not found: %v", err)
+		}
+		if err := repo.Restore("a"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Restore of a live stream = %v, want ErrNotFound", err)
+		}
+
+		deleted, err := repo.GetDeleted()
+		mustNoError(t, err)
+		if len(deleted) != 1 || deleted[0].UUID != "b" {
+			t.Fatalf("GetDeleted = %+v, want only b", deleted)
+		}
+		if err := repo.Purge("a"); !errors.Is(err, repository.ErrNotFound) {
+			t.Fatalf("Purge of a live stream = %v, want ErrNotFound", err)
+		}
+		mustNoError(t, repo.Purge("b"))
+		deleted, err = repo.GetDeleted()
+		mustNoError(t, err)
+		if len(deleted) != 0 {
+			t.Fatalf("GetDeleted after purge returned %d streams, want 0", len(deleted))
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := newRepo(t)
+		stream := &models.Stream{UUID: "a", URL: "rtsp://camera/a"}
+		mustNoError(t, repo.Create(stream))
+
+		stream.URL = "rtsp://camera/b"
+		stream.Debug = true
+		mustNoError(t, repo.Update(stream))
+
+		got, err := repo.GetByUUID("a")
+		mustNoError(t, err)
+		if got.URL != "rtsp://camera/b" || !got.Debug {
+			t.Fatalf("Update not persisted: %+v", got)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := newRepo(t)
+		mustNoError(t, repo.Create(&models.Stream{UUID: "a", URL: "rtsp://camera/a"}))
+		mustNoError(t, repo.Delete("a"))
+
+		if _, err := repo.GetByUUID("a"); err == nil {
+			t.Fatalf("deleted stream is still returned by GetByUUID")
+		}
+		all, err := repo.GetAll()
+		mustNoError(t, err)
+		if len(all) != 0 {
+			t.Fatalf("GetAll returned %d streams after delete, want 0", len(all))
+		}
+	})
+
+	t.Run("Filters", func(t *testing.T) {
+		repo := newRepo(t)
+		mustNoError(t, repo.Create(&models.Stream{UUID: "live", URL: "rtsp://camera/live"}))
+		mustNoError(t, repo.Create(&models.Stream{UUID: "demand", URL: "rtsp://camera/demand", OnDemand: true}))
+		mustNoError(t, repo.Create(&models.Stream{UUID: "adhoc", URL: "rtsp://camera/adhoc", OnDemand: true, Ephemeral: true}))
+
+		all, err := repo.GetAll()
+		mustNoError(t, err)
+		if len(all) != 3 {
+			t.Fatalf("GetAll returned %d streams, want 3", len(all))
+		}
+		expectUUIDs(t, "GetNonDemandStreams", repo.GetNonDemandStreams, "live")
+		expectUUIDs(t, "GetEphemeralStreams", repo.GetEphemeralStreams, "adhoc")
+	})
+
+	t.Run("Metadata", func(t *testing.T) {
+		repo := newRepo(t)
+		lat, lon := -6.2, 106.8
+		mustNoError(t, repo.Create(&models.Stream{
+			UUID:        "gate",
+			URL:         "rtsp://camera/gate",
+			DisplayName: "Main Gate",
+			Site:        "jakarta",
+			Latitude:    &lat,
+			Longitude:   &lon,
+			Tags:        models.StringList{"entrance", "outdoor"},
+			Metadata:    models.JSONMap{"vendor": "hikvision"},
+		}))
+		mustNoError(t, repo.Create(&models.Stream{
+			UUID:        "lobby",
+			URL:         "rtsp://camera/lobby",
+			Description: "Lobby near the main entrance",
+			Site:        "bandung",
+			Tags:        models.StringList{"indoor", "out_door"},
+		}))
+		mustNoError(t, repo.Create(&models.Stream{UUID: "bare", URL: "rtsp://camera/bare"}))
+
+		got, err := repo.GetByUUID("gate")
+		mustNoError(t, err)
+		if got.Latitude == nil || *got.Latitude != lat || len(got.Tags) != 2 || got.Metadata["vendor"] != "hikvision" {
+			t.Fatalf("metadata not persisted: %+v", got)
+		}
+
+		list := func(filter models.StreamFilter) func() ([]models.Stream, error) {
+			return func() ([]models.Stream, error) {
+				streams, _, _, err := repo.List(filter)
+				return streams, err
+			}
+		}
+		expectUUIDs(t, "List()", list(models.StreamFilter{}), "gate", "lobby", "bare")
+		expectUUIDs(t, "List(tag)", list(models.StreamFilter{Tags: []string{"outdoor"}}), "gate")
+		expectUUIDs(t, "List(tags)", list(models.StreamFilter{Tags: []string{"indoor", "out_door"}}), "lobby")
+		expectUUIDs(t, "List(site)", list(models.StreamFilter{Site: "bandung"}), "lobby")
+		expectUUIDs(t, "List(q)", list(models.StreamFilter{Search: "MAIN"}), "gate", "lobby")
+		expectUUIDs(t, "List(q, site)", list(models.StreamFilter{Search: "main", Site: "jakarta"}), "gate")
+		expectUUIDs(t, "List(q%)", list(models.StreamFilter{Search: "%"}))
+	})
+
+	t.Run("Paginate", func(t *testing.T) {
+		repo := newRepo(t)
+		for _, s := range []struct{ uuid, site, group string }{
+			{"a", "north", "lobby"},
+			{"b", "south", "gate"},
+			{"c", "north", "gate"},
+			{"d", "south", "lobby"},
+			{"e", "north", "gate"},
+		} {
+			mustNoError(t, repo.Create(&models.Stream{
+				UUID: s.uuid, URL: "rtsp://camera/" + s.uuid, Site: s.site, Group: s.group, OnDemand: s.uuid == "b",
+			}))
+		}
+
+		collect := func(filter models.StreamFilter) ([]string, int64) {
+			t.Helper()
+			var uuids []string
+			var total int64
+			for pages := 0; pages < 10; pages++ {
+				streams, n, next, err := repo.List(filter)
+				mustNoError(t, err)
+				total = n
+				for _, stream := range streams {
+					uuids = append(uuids, stream.UUID)
+				}
+				if next == "" {
+					return uuids, total
+				}
+				filter.Cursor = next
+			}
+			t.Fatalf("List did not reach the last page")
+			return nil, 0
+		}
+		expect := func(name string, filter models.StreamFilter, wantTotal int64, want ...string) {
+			t.Helper()
+			got, total := collect(filter)
+			if total != wantTotal || strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Fatalf("%s = %v of %d, want %v of %d", name, got, total, want, wantTotal)
+			}
+		}
+
+		expect("created", models.StreamFilter{Limit: 2}, 5, "a", "b", "c", "d", "e")
+		expect("created desc", models.StreamFilter{Limit: 2, Desc: true}, 5, "e", "d", "c", "b", "a")
+		expect("site", models.StreamFilter{Sort: models.StreamSortSite, Limit: 2}, 5, "a", "c", "e", "b", "d")
+		expect("group desc", models.StreamFilter{Sort: models.StreamSortGroup, Desc: true, Limit: 1}, 5, "d", "a", "e", "c", "b")
+		expect("group filter", models.StreamFilter{Group: "gate", Limit: 1}, 3, "b", "c", "e")
+		onDemand := false
+		expect("on_demand", models.StreamFilter{OnDemand: &onDemand, Site: "south"}, 1, "d")
+		live := true
+		expect("live", models.StreamFilter{Live: &live, LiveUUIDs: []string{"c", "d"}}, 2, "c", "d")
+		expect("live none", models.StreamFilter{Live: &live}, 0)
+		live = false
+		expect("not live", models.StreamFilter{Live: &live, LiveUUIDs: []string{"c", "d"}}, 3, "a", "b", "e")
+
+		if _, _, _, err := repo.List(models.StreamFilter{Sort: "bogus"}); !errors.Is(err, repository.ErrInvalidSort) {
+			t.Fatalf("List with unknown sort returned %v, want ErrInvalidSort", err)
+		}
+		_, _, next, err := repo.List(models.StreamFilter{Limit: 1})
+		mustNoError(t, err)
+		if _, _, _, err := repo.List(models.StreamFilter{Sort: models.StreamSortSite, Cursor: next}); !errors.Is(err, repository.ErrInvalidCursor) {
+			t.Fatalf("List with a cursor of another sort returned %v, want ErrInvalidCursor", err)
+		}
+	})
+}
+
+// RunAuditRepository runs the audit repository conformance suite
+func RunAuditRepository(t *testing.T, newRepo AuditRepositoryFactory) {
+	t.Run("FilterAndPaginate", func(t *testing.T) {
+		repo := newRepo(t)
+		base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		for i := 0; i < 5; i++ {
+			actor := "alice"
+			if i%2 == 1 {
+				actor = "bob"
+			}
+			mustNoError(t, repo.Create(&models.AuditLog{
+				CreatedAt: base.Add(time.Duration(i) * time.Hour),
+				Actor:     actor,
+				Action:    models.AuditActionStreamUpdate,
+				Resource:  "a",
+			}))
+		}
+
+		entries, total, err := repo.List(models.AuditFilter{Actor: "alice", Page: 1, PageSize: 2})
+		mustNoError(t, err)
+		if total != 3 || len(entries) != 2 {
+			t.Fatalf("List returned %d of %d entries, want 2 of 3", len(entries), total)
+		}
+		if !entries[0].CreatedAt.After(entries[1].CreatedAt) {
+			t.Fatalf("List is not ordered newest first")
+		}
+
+		entries, total, err = repo.List(models.AuditFilter{From: base.Add(3 * time.Hour), Page: 1, PageSize: 10})
+		mustNoError(t, err)
+		if total != 2 || len(entries) != 2 {
+			t.Fatalf("time filtered List returned %d of %d entries, want 2 of 2", len(entries), total)
+		}
+	})
+}
+
+func expectUUIDs(t *testing.T, name string, list func() ([]models.Stream, error), want ...string) {
+	t.Helper()
+	streams, err := list()
+	mustNoError(t, err)
+	if len(streams) != len(want) {
+		t.Fatalf("%s returned %d streams, want %d", name, len(streams), len(want))
+	}
+	for i, stream := range streams {
+		if stream.UUID != want[i] {
+			t.Fatalf("%s[%d] = %q, want %q", name, i, stream.UUID, want[i])
+		}
+	}
+}
+
+func mustNoError(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
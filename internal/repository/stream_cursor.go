@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+)
+
+var (
+	// ErrInvalidSort is returned for an unknown stream sort key
+	ErrInvalidSort = errors.New("invalid sort key")
+	// ErrInvalidCursor is returned for a cursor that cannot be decoded or
+	// was issued for a different sort order
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// streamSortColumns maps sort keys to the SQL expression ordered by. Every
+// listing is ordered by id last, which keeps the keyset unique.
+var streamSortColumns = map[string]string{
+	models.StreamSortCreated:     "",
+	models.StreamSortName:        "COALESCE(name, '')",
+	models.StreamSortDisplayName: "display_name",
+	models.StreamSortSite:        "site",
+	models.StreamSortGroup:       "group_name",
+}
+
+// streamCursor is the position after the last stream of a page
+type streamCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d,omitempty"`
+	Value string `json:"v,omitempty"`
+	ID    uint   `json:"id"`
+}
+
+func newStreamCursor(sort string, desc bool, last models.Stream) streamCursor {
+	cursor := streamCursor{Sort: sort, Desc: desc, ID: last.ID}
+	switch sort {
+	case models.StreamSortName:
+		if last.Name != nil {
+			cursor.Value = *last.Name
+		}
+	case models.StreamSortDisplayName:
+		cursor.Value = last.DisplayName
+	case models.StreamSortSite:
+		cursor.Value = last.Site
+	case models.StreamSortGroup:
+		cursor.Value = last.Group
+	}
+	return cursor
+}
+
+func (c streamCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeStreamCursor parses a cursor and checks it matches the sort order
+func decodeStreamCursor(s string, sort string, desc bool) (streamCursor, error) {
+	var cursor streamCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &cursor); err != nil {
+		return cursor, ErrInvalidCursor
+	}
+	if cursor.Sort != sort || cursor.Desc != desc {
+		return cursor, ErrInvalidCursor
+	}
+	return cursor, nil
+}
@@ -1,18 +1,27 @@
 package repository
 
 import (
+	"encoding/json"
+	"strings"
+
 	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
 	"gorm.io/gorm"
 )
 
 type StreamRepository interface {
 	GetAll() ([]models.Stream, error)
+	List(filter models.StreamFilter) (streams []models.Stream, total int64, next string, err error)
 	GetByUUID(uuid string) (*models.Stream, error)
 	GetByURL(url string) (*models.Stream, error)
+	GetByName(name string) (*models.Stream, error)
 	Create(stream *models.Stream) error
 	Update(stream *models.Stream) error
 	Delete(uuid string) error
 	GetNonDemandStreams() ([]models.Stream, error)
+	GetEphemeralStreams() ([]models.Stream, error)
+	GetDeleted() ([]models.Stream, error)
+	Restore(uuid string) error
+	Purge(uuid string) error
 }
 
 type streamRepository struct {
@@ -29,22 +38,136 @@ func (r *streamRepository) GetAll() ([]models.Stream, error) {
 	return streams, err
 }
 
+// List returns a page of the streams matching filter together with the
+// total number of matches and the cursor of the next page, which is empty
+// on the last page.
+func (r *streamRepository) List(filter models.StreamFilter) ([]models.Stream, int64, string, error) {
+	sort := filter.Sort
+	if sort == "" {
+		sort = models.StreamSortCreated
+	}
+	column, ok := streamSortColumns[sort]
+	if !ok {
+		return nil, 0, "", ErrInvalidSort
+	}
+
+	query, err := r.filterStreams(filter)
+	if err != nil {
+		return nil, 0, "", err
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, "", err
+	}
+
+	direction, compare := "ASC", ">"
+	if filter.Desc {
+		direction, compare = "DESC", "<"
+	}
+	if filter.Cursor != "" {
+		cursor, err := decodeStreamCursor(filter.Cursor, sort, filter.Desc)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		if column == "" {
+			query = query.Where("id "+compare+" ?", cursor.ID)
+		} else {
+			query = query.Where(
+				"("+column+" "+compare+" ? OR ("+column+" = ? AND id "+compare+" ?))",
+				cursor.Value, cursor.Value, cursor.ID,
+			)
+		}
+	}
+	if column != "" {
+		query = query.Order(column + " " + direction)
+	}
+	query = query.Order("id " + direction)
+	if filter.Limit > 0 {
+		// One extra row tells whether another page follows
+		query = query.Limit(filter.Limit + 1)
+	}
+
+	var streams []models.Stream
+	if err := query.Find(&streams).Error; err != nil {
+		return nil, 0, "", err
+	}
+
+	var next string
+	if filter.Limit > 0 && len(streams) > filter.Limit {
+		streams = streams[:filter.Limit]
+		next = newStreamCursor(sort, filter.Desc, streams[len(streams)-1]).encode()
+	}
+	return streams, total, next, nil
+}
+
+// filterStreams applies the filter conditions of a listing
+func (r *streamRepository) filterStreams(filter models.StreamFilter) (*gorm.DB, error) {
+	query := r.db.Model(&models.Stream{})
+	for _, tag := range filter.Tags {
+		// Tags are stored as a JSON array, so match the encoded element
+		encoded, err := json.Marshal(tag)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(`tags LIKE ? ESCAPE '\'`, "%"+escapeLike(string(encoded))+"%")
+	}
+	if filter.Site != "" {
+		query = query.Where("site = ?", filter.Site)
+	}
+	if filter.Group != "" {
+		query = query.Where("group_name = ?", filter.Group)
+	}
+	if filter.OnDemand != nil {
+		query = query.Where("on_demand = ?", *filter.OnDemand)
+	}
+	if filter.Live != nil {
+		switch {
+		case *filter.Live && len(filter.LiveUUIDs) == 0:
+			query = query.Where("1 = 0")
+		case *filter.Live:
+			query = query.Where("uuid IN ?", filter.LiveUUIDs)
+		case len(filter.LiveUUIDs) > 0:
+			query = query.Where("uuid NOT IN ?", filter.LiveUUIDs)
+		}
+	}
+	if filter.Search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(filter.Search)) + "%"
+		query = query.Where(
+			`(LOWER(COALESCE(name, '')) LIKE ? ESCAPE '\' OR LOWER(display_name) LIKE ? ESCAPE '\'`+
+				` OR LOWER(description) LIKE ? ESCAPE '\' OR LOWER(site) LIKE ? ESCAPE '\')`,
+			pattern, pattern, pattern, pattern,
+		)
+	}
+	return query, nil
+}
+
 func (r *streamRepository) GetByUUID(uuid string) (*models.Stream, error) {
 	var stream models.Stream
 	err := r.db.Where("uuid = ?", uuid).First(&stream).Error
-	return &stream, err
+	if err != nil {
+		return nil, translateError(err)
+	}
+	return &stream, nil
 }
 
 func (r *streamRepository) Create(stream *models.Stream) error {
-	return r.db.Create(stream).Error
+	return translateError(r.db.Create(stream).Error)
 }
 
 func (r *streamRepository) Update(stream *models.Stream) error {
-	return r.db.Save(stream).Error
+	return translateError(r.db.Save(stream).Error)
 }
 
 func (r *streamRepository) Delete(uuid string) error {
-	return r.db.Where("uuid = ?", uuid).Delete(&models.Stream{}).Error
+	result := r.db.Where("uuid = ?", uuid).Delete(&models.Stream{})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
 }
 
 func (r *streamRepository) GetNonDemandStreams() ([]models.Stream, error) {
@@ -53,11 +176,68 @@ func (r *streamRepository) GetNonDemandStreams() ([]models.Stream, error) {
 	return streams, err
 }
 
+// GetByURL returns the oldest stream using url; several streams may share one
 func (r *streamRepository) GetByURL(url string) (*models.Stream, error) {
 	var stream models.Stream
-	result := r.db.Where("url = ?", url).First(&stream)
+	result := r.db.Where("url = ?", url).Order("id").First(&stream)
 	if result.Error != nil {
-		return nil, result.Error
+		return nil, translateError(result.Error)
+	}
+	return &stream, nil
+}
+
+func (r *streamRepository) GetByName(name string) (*models.Stream, error) {
+	var stream models.Stream
+	err := r.db.Where("name = ?", name).First(&stream).Error
+	if err != nil {
+		return nil, translateError(err)
 	}
 	return &stream, nil
 }
+
+func (r *streamRepository) GetEphemeralStreams() ([]models.Stream, error) {
+	var streams []models.Stream
+	err := r.db.Where("ephemeral = ?", true).Find(&streams).Error
+	return streams, err
+}
+
+// GetDeleted returns soft-deleted streams, most recently deleted first
+func (r *streamRepository) GetDeleted() ([]models.Stream, error) {
+	var streams []models.Stream
+	err := r.db.Unscoped().Where("deleted_at IS NOT NULL").Order("deleted_at DESC").Find(&streams).Error
+	return streams, err
+}
+
+// Restore undeletes a soft-deleted stream. It fails with ErrConflict when a
+// live stream took its UUID or name in the meantime.
+func (r *streamRepository) Restore(uuid string) error {
+	result := r.db.Unscoped().Model(&models.Stream{}).
+		Where("uuid = ? AND deleted_at IS NOT NULL", uuid).
+		Update("deleted_at", nil)
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Purge permanently removes a soft-deleted stream
+func (r *streamRepository) Purge(uuid string) error {
+	result := r.db.Unscoped().
+		Where("uuid = ? AND deleted_at IS NOT NULL", uuid).
+		Delete(&models.Stream{})
+	if result.Error != nil {
+		return translateError(result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// escapeLike escapes the LIKE wildcards in s so it is matched literally
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,202 @@
+package usecase
+
+import (
+	"encoding/json"
+	"log"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
+)
+
+const (
+	defaultAuditPageSize = 50
+	maxAuditPageSize     = 500
+	// redactedPassword replaces passwords in audit snapshots and stream
+	// responses
+	redactedPassword = "redacted"
+)
+
+// AuditUseCase records and queries the administrative audit trail
+type AuditUseCase interface {
+	Record(actor models.Actor, action string, resource string, before, after interface{})
+	List(filter models.AuditFilter) (*models.AuditLogPage, error)
+}
+
+type auditUseCase struct {
+	auditRepo repository.AuditRepository
+}
+
+// NewAuditUseCase creates a new instance of AuditUseCase
+func NewAuditUseCase(auditRepo repository.AuditRepository) AuditUseCase {
+	return &auditUseCase{
+		auditRepo: auditRepo,
+	}
+}
+
+// Record stores an audit entry. Failures are logged but never returned so
+// that auditing cannot break the action being audited. Passwords in URLs of
+// the snapshots are redacted.
+func (u *auditUseCase) Record(actor models.Actor, action string, resource string, before, after interface{}) {
+	beforeMap := redactAuditMap(toAuditMap(before))
+	afterMap := redactAuditMap(toAuditMap(after))
+
+	entry := &models.AuditLog{
+		Actor:    actor.Name,
+		SourceIP: actor.IP,
+		Action:   action,
+		Resource: resource,
+		Before:   marshalAuditValue(beforeMap),
+		After:    marshalAuditValue(afterMap),
+		Changes:  marshalAuditValue(diffAuditMaps(beforeMap, afterMap)),
+	}
+	if err := u.auditRepo.Create(entry); err != nil {
+		log.Printf("[Audit] Failed to record %s on %s by %s: %v", action, resource, actor.Name, err)
+	}
+}
+
+func (u *auditUseCase) List(filter models.AuditFilter) (*models.AuditLogPage, error) {
+	if filter.Page < 1 {
+		filter.Page = 1
+	}
+	if filter.PageSize < 1 {
+		filter.PageSize = defaultAuditPageSize
+	}
+	if filter.PageSize > maxAuditPageSize {
+		filter.PageSize = maxAuditPageSize
+	}
+
+	entries, total, err := u.auditRepo.List(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.AuditLogPage{
+		Items:    make([]models.AuditLogResponse, 0, len(entries)),
+		Total:    total,
+		Page:     filter.Page,
+		PageSize: filter.PageSize,
+	}
+	for _, entry := range entries {
+		page.Items = append(page.Items, models.AuditLogResponse{
+			ID:        entry.ID,
+			Timestamp: entry.CreatedAt,
+			Actor:     entry.Actor,
+			SourceIP:  entry.SourceIP,
+			Action:    entry.Action,
+			Resource:  entry.Resource,
+			Before:    rawAuditValue(entry.Before),
+			After:     rawAuditValue(entry.After),
+			Changes:   rawAuditValue(entry.Changes),
+		})
+	}
+	return page, nil
+}
+
+// toAuditMap converts a snapshot into its JSON object form
+func toAuditMap(value interface{}) map[string]interface{} {
+	if value == nil || (reflect.ValueOf(value).Kind() == reflect.Ptr && reflect.ValueOf(value).IsNil()) {
+		return nil
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil
+	}
+	return m
+}
+
+// redactAuditMap replaces the password of every URL value with
+// redactedPassword. The user name is kept, so credential changes still show
+// in the diff when the user changes.
+func redactAuditMap(m map[string]interface{}) map[string]interface{} {
+	for key, value := range m {
+		if s, ok := value.(string); ok {
+			m[key] = redactURLPassword(s)
+		}
+	}
+	return m
+}
+
+// redactURLPassword replaces the password in the user info of rawURL with
+// redactedPassword and returns other values unchanged
+func redactURLPassword(rawURL string) string {
+	if !strings.Contains(rawURL, "@") {
+		return rawURL
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return rawURL
+	}
+	if _, hasPassword := parsed.User.Password(); !hasPassword {
+		return rawURL
+	}
+	parsed.User = url.UserPassword(parsed.User.Username(), redactedPassword)
+	return parsed.String()
+}
+
+// restoreURLPassword puts the password of storedURL back into rawURL when
+// rawURL carries the redacted placeholder, so a stream read from the API
+// can be sent back unchanged
+func restoreURLPassword(rawURL, storedURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return rawURL
+	}
+	if password, _ := parsed.User.Password(); password != redactedPassword {
+		return rawURL
+	}
+	stored, err := url.Parse(storedURL)
+	if err != nil || stored.User == nil {
+		return rawURL
+	}
+	storedPassword, hasPassword := stored.User.Password()
+	if !hasPassword {
+		return rawURL
+	}
+	parsed.User = url.UserPassword(parsed.User.Username(), storedPassword)
+	return parsed.String()
+}
+
+// diffAuditMaps returns the fields that differ between two snapshots
+func diffAuditMaps(before, after map[string]interface{}) map[string]interface{} {
+	changes := make(map[string]interface{})
+	for key, oldValue := range before {
+		newValue, ok := after[key]
+		if !ok || !reflect.DeepEqual(oldValue, newValue) {
+			changes[key] = map[string]interface{}{"from": oldValue, "to": newValue}
+		}
+	}
+	for key, newValue := range after {
+		if _, ok := before[key]; !ok {
+			changes[key] = map[string]interface{}{"from": nil, "to": newValue}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return changes
+}
+
+func marshalAuditValue(value map[string]interface{}) string {
+	if value == nil {
+		return ""
+	}
+	b, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func rawAuditValue(value string) json.RawMessage {
+	if value == "" {
+		return nil
+	}
+	return json.RawMessage(value)
+}
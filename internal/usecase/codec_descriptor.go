@@ -0,0 +1,82 @@
+package usecase
+
+import (
+	"fmt"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/deepch/vdk/av"
+	"github.com/deepch/vdk/codec/h264parser"
+	"github.com/deepch/vdk/codec/h265parser"
+)
+
+// describeCodec returns what the codec data tells about a track
+func describeCodec(codec av.CodecData) models.CodecDescriptor {
+	desc := models.CodecDescriptor{
+		Type:  "audio",
+		Codec: codec.Type().String(),
+	}
+	if codec.Type().IsVideo() {
+		desc.Type = "video"
+	}
+
+	switch c := codec.(type) {
+	case h264parser.CodecData:
+		desc.Width, desc.Height = c.Width(), c.Height()
+		desc.FPS = c.FPS()
+		if c.SPSInfo.ProfileIdc != 0 {
+			desc.Profile = h264ProfileName(c.SPSInfo.ProfileIdc, c.RecordInfo.ProfileCompatibility)
+			desc.Level = fmt.Sprintf("%d.%d", c.SPSInfo.LevelIdc/10, c.SPSInfo.LevelIdc%10)
+		}
+		if sps := c.SPS(); len(sps) >= 4 {
+			desc.ProfileLevelID = fmt.Sprintf("%02x%02x%02x", sps[1], sps[2], sps[3])
+		}
+	case h265parser.CodecData:
+		desc.Width, desc.Height = c.Width(), c.Height()
+		desc.FPS = c.FPS()
+		if c.SPSInfo.ProfileIdc != 0 {
+			desc.Profile = h265ProfileName(c.SPSInfo.ProfileIdc)
+			desc.Level = fmt.Sprintf("%g", float64(c.SPSInfo.LevelIdc)/30)
+		}
+	case av.AudioCodecData:
+		desc.SampleRate = c.SampleRate()
+		desc.Channels = c.ChannelLayout().Count()
+	}
+	return desc
+}
+
+func h264ProfileName(idc uint, compatibility uint8) string {
+	switch idc {
+	case 66:
+		if compatibility&0x40 != 0 {
+			return "Constrained Baseline"
+		}
+		return "Baseline"
+	case 77:
+		return "Main"
+	case 88:
+		return "Extended"
+	case 100:
+		return "High"
+	case 110:
+		return "High 10"
+	case 122:
+		return "High 4:2:2"
+	case 244:
+		return "High 4:4:4"
+	default:
+		return fmt.Sprintf("profile_idc %d", idc)
+	}
+}
+
+func h265ProfileName(idc uint) string {
+	switch idc {
+	case 1:
+		return "Main"
+	case 2:
+		return "Main 10"
+	case 3:
+		return "Main Still Picture"
+	default:
+		return fmt.Sprintf("profile_idc %d", idc)
+	}
+}
@@ -0,0 +1,94 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
+	"github.com/DaffaJatmiko/stream_camera/pkg/utils"
+)
+
+// ImportConfigStreams copies the streams of the config file's streams map
+// into the repository, using the map key as the stream name. Streams whose
+// URL or name is already stored, or whose URL an earlier stream of the same
+// import takes, are skipped, in a dry run as in a real one.
+func (u *streamUseCase) ImportConfigStreams(actor models.Actor, dryRun bool) (*models.StreamImportReport, error) {
+	ids := u.cfg.FileStreams()
+	report := &models.StreamImportReport{
+		DryRun: dryRun,
+		Rows:   make([]models.StreamImportResult, 0, len(ids)),
+	}
+	// Names are unique map keys; URLs may repeat between entries
+	imported := make(map[string]models.StreamImportResult, len(ids))
+
+	for i, id := range ids {
+		result := models.StreamImportResult{Row: i + 1, Name: id}
+		source, ok := u.cfg.GetStream(id)
+		if !ok {
+			// Removed by a reload while importing
+			continue
+		}
+		if first, ok := imported[source.URL]; ok {
+			result.Status = models.StreamImportSkipped
+			result.UUID = first.UUID
+			result.Reason = fmt.Sprintf("url already imported as %s by row %d", first.Name, first.Row)
+			report.Skipped++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+
+		existing, err := u.streamRepo.GetByURL(source.URL)
+		if err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return nil, err
+		}
+		if existing == nil {
+			existing, err = u.findStreamByName(&id)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if existing != nil {
+			result.Status = models.StreamImportSkipped
+			result.UUID = existing.UUID
+			if existing.URL == source.URL {
+				result.Reason = "url already stored"
+			} else {
+				result.Reason = "name already used by a stream with another url"
+			}
+			report.Skipped++
+			report.Rows = append(report.Rows, result)
+			continue
+		}
+
+		name := id
+		stream := &models.Stream{
+			Name:           &name,
+			URL:            source.URL,
+			OnDemand:       source.OnDemand,
+			Debug:          source.Debug,
+			DisableAudio:   source.DisableAudio,
+			AudioTranscode: source.AudioTranscode,
+			Backchannel:    source.Backchannel,
+		}
+		if err := validateStream(stream); err != nil {
+			failImportRow(report, result, err)
+			continue
+		}
+
+		result.Status = models.StreamImportCreated
+		if !dryRun {
+			stream.UUID = utils.GenerateUUID()
+			if err := u.streamRepo.Create(stream); err != nil {
+				failImportRow(report, result, err)
+				continue
+			}
+			u.auditUseCase.Record(actor, models.AuditActionStreamCreate, stream.UUID, nil, stream)
+			result.UUID = stream.UUID
+		}
+		imported[source.URL] = result
+		report.Created++
+		report.Rows = append(report.Rows, result)
+	}
+	return report, nil
+}
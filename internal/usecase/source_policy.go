@@ -0,0 +1,153 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+)
+
+var (
+	// ErrURLPlaybackDisabled is returned when ad-hoc URL playback is turned off
+	ErrURLPlaybackDisabled = errors.New("url playback is disabled")
+	// ErrSourceNotAllowed is wrapped by every source policy violation
+	ErrSourceNotAllowed = errors.New("source url not allowed")
+)
+
+var defaultSchemePorts = map[string]int{
+	"rtsp":  554,
+	"rtsps": 322,
+}
+
+// privateNetworks are refused unless server.source_policy.allowed_cidrs
+// lists the addresses a source may resolve to, so ad-hoc playback cannot
+// reach the host itself, the local network or cloud metadata services.
+var privateNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.168.0.0/16",
+	"224.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+// lookupIP resolves source hosts; tests replace it
+var lookupIP = net.LookupIP
+
+// checkSourceURL validates rawURL against the configured source policy and
+// returns the URL to dial. Host names are resolved once and every address
+// must fall inside the allowed CIDRs, or outside the private networks when
+// none are configured. Plain RTSP URLs are pinned to the validated address
+// so a second lookup cannot rebind the name to a disallowed network; RTSPS
+// keeps the name, which the certificate check binds the connection to.
+func checkSourceURL(policy config.SourcePolicyConfig, rawURL string) (string, error) {
+	if policy.DisableURLPlayback {
+		return "", ErrURLPlaybackDisabled
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("%w: malformed url", ErrSourceNotAllowed)
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if !containsFold(policy.AllowedSchemes, scheme) {
+		return "", fmt.Errorf("%w: scheme %q", ErrSourceNotAllowed, scheme)
+	}
+
+	port := defaultSchemePorts[scheme]
+	if p := u.Port(); p != "" {
+		if port, err = strconv.Atoi(p); err != nil {
+			return "", fmt.Errorf("%w: port %q", ErrSourceNotAllowed, p)
+		}
+	}
+	if len(policy.AllowedPorts) > 0 && !containsInt(policy.AllowedPorts, port) {
+		return "", fmt.Errorf("%w: port %d", ErrSourceNotAllowed, port)
+	}
+
+	var allowed []*net.IPNet
+	if len(policy.AllowedCIDRs) > 0 {
+		if allowed, err = parseCIDRs(policy.AllowedCIDRs); err != nil {
+			return "", err
+		}
+	}
+	addrs, err := lookupIP(u.Hostname())
+	if err != nil || len(addrs) == 0 {
+		return "", fmt.Errorf("%w: cannot resolve host %q", ErrSourceNotAllowed, u.Hostname())
+	}
+	for _, addr := range addrs {
+		if allowed != nil && !containsIP(allowed, addr) || allowed == nil && containsIP(privateNetworks, addr) {
+			return "", fmt.Errorf("%w: address %s", ErrSourceNotAllowed, addr)
+		}
+	}
+
+	if scheme != "rtsp" {
+		return rawURL, nil
+	}
+	host := addrs[0].String()
+	if p := u.Port(); p != "" {
+		host = net.JoinHostPort(host, p)
+	} else if addrs[0].To4() == nil {
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	return u.String(), nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed cidr %q: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks, err := parseCIDRs(cidrs)
+	if err != nil {
+		panic(err)
+	}
+	return networks
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/pkg/transcode"
+	"github.com/deepch/vdk/av"
+	"github.com/deepch/vdk/format/rtspv2"
+)
+
+const (
+	defaultProbeTimeout = 5 * time.Second
+	maxProbeTimeout     = 30 * time.Second
+)
+
+// ErrInvalidProbeURL is returned for a probe URL that is not rtsp:// or rtsps://
+var ErrInvalidProbeURL = errors.New("probe url must be an rtsp:// or rtsps:// URL")
+
+// ProbeFailedError is returned by CreateStream when a required probe did not pass
+type ProbeFailedError struct {
+	Result *models.StreamProbeResult
+}
+
+func (e *ProbeFailedError) Error() string {
+	if e.Result.Error != "" {
+		return "stream probe failed: " + e.Result.Error
+	}
+	return "stream probe failed: no WebRTC compatible track"
+}
+
+// ProbeStream connects to an RTSP source for at most the requested timeout
+// and reports reachability, authentication and the tracks it offers. Probes
+// check cameras operators are about to add, usually on the local network,
+// so the ad-hoc playback source policy does not apply to them.
+func (u *streamUseCase) ProbeStream(req models.StreamProbeRequest) (*models.StreamProbeResult, error) {
+	rawURL, err := probeURL(req)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := defaultProbeTimeout
+	if req.TimeoutSeconds > 0 {
+		timeout = time.Duration(req.TimeoutSeconds) * time.Second
+	}
+	if timeout > maxProbeTimeout {
+		timeout = maxProbeTimeout
+	}
+	return probeRTSP(rawURL, timeout), nil
+}
+
+// probeURL validates the URL and applies the request's credentials
+func probeURL(req models.StreamProbeRequest) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(req.URL))
+	if err != nil || parsed.Host == "" {
+		return "", ErrInvalidProbeURL
+	}
+	if scheme := strings.ToLower(parsed.Scheme); scheme != "rtsp" && scheme != "rtsps" {
+		return "", ErrInvalidProbeURL
+	}
+	if req.Username != "" || req.Password != "" {
+		parsed.User = url.UserPassword(req.Username, req.Password)
+	}
+	return parsed.String(), nil
+}
+
+type probeDial struct {
+	client *rtspv2.RTSPClient
+	err    error
+}
+
+func probeRTSP(rawURL string, timeout time.Duration) *models.StreamProbeResult {
+	start := time.Now()
+	result := &models.StreamProbeResult{Auth: models.ProbeAuthNotAttempted, Tracks: []models.ProbeTrack{}}
+	defer func() { result.DurationMs = time.Since(start).Milliseconds() }()
+
+	// rtspv2 only bounds single reads and writes, so bound the whole
+	// handshake here and close a late client in the background
+	dialed := make(chan probeDial, 1)
+	go func() {
+		client, err := rtspv2.Dial(rtspv2.RTSPClientOptions{
+			URL:              rawURL,
+			DialTimeout:      timeout,
+			ReadWriteTimeout: timeout,
+		})
+		dialed <- probeDial{client: client, err: err}
+	}()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	var dial probeDial
+	select {
+	case dial = <-dialed:
+	case <-deadline.C:
+		go func() {
+			if late := <-dialed; late.client != nil {
+				late.client.Close()
+			}
+		}()
+		result.Error = fmt.Sprintf("timed out after %s", timeout)
+		return result
+	}
+	if dial.err != nil {
+		classifyProbeError(result, dial.err)
+		return result
+	}
+	client := dial.client
+	defer client.Close()
+
+	result.Reachable = true
+	result.Auth = models.ProbeAuthOK
+
+	// Without parameter sets in the SDP the codec is only known once the
+	// first SPS/PPS arrive in-band
+	if client.WaitCodec {
+	wait:
+		for {
+			select {
+			case signal := <-client.Signals:
+				if signal == rtspv2.SignalCodecUpdate {
+					break wait
+				}
+				if signal == rtspv2.SignalStreamRTPStop {
+					break wait
+				}
+			case <-deadline.C:
+				break wait
+			}
+		}
+	}
+
+	var hasVideo, videoOK, audioOK bool
+	for _, codec := range client.CodecData {
+		track := probeTrack(codec, client.FPS)
+		result.Tracks = append(result.Tracks, track)
+		if track.Type == "video" {
+			hasVideo = true
+			videoOK = videoOK || track.WebRTC
+		} else {
+			audioOK = audioOK || track.WebRTC
+		}
+	}
+	if hasVideo {
+		result.WebRTCCompatible = videoOK
+	} else {
+		result.WebRTCCompatible = audioOK
+	}
+	return result
+}
+
+// classifyProbeError fills in the result for a failed RTSP handshake
+func classifyProbeError(result *models.StreamProbeResult, err error) {
+	result.Error = err.Error()
+
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &dnsErr), errors.As(err, &opErr), errors.As(err, &netErr):
+		return
+	case strings.Contains(result.Error, "401"):
+		result.Reachable = true
+		result.Auth = models.ProbeAuthFailed
+	case strings.Contains(result.Error, " 403"):
+		result.Reachable = true
+		result.Auth = models.ProbeAuthFailed
+	default:
+		result.Reachable = true
+		result.Auth = models.ProbeAuthUnknown
+	}
+}
+
+func probeTrack(codec av.CodecData, sdpFPS int) models.ProbeTrack {
+	track := models.ProbeTrack{
+		CodecDescriptor: describeCodec(codec),
+		WebRTC:          isCodecSupported(codec),
+	}
+	if track.Type == "video" && track.FPS == 0 {
+		track.FPS = sdpFPS
+	} else if track.Type == "audio" && !track.WebRTC {
+		track.Transcodable = transcode.CanDecode(codec.Type())
+	}
+	return track
+}
@@ -0,0 +1,36 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+)
+
+func TestProbeStreamReachesPrivateCameras(t *testing.T) {
+	// The default source policy refuses private addresses for ad-hoc playback
+	if _, err := config.Load([]string{"-env_file", "none"}); err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	streams, _ := newTestStreamUseCase(t)
+	const camera = "rtsp://192.168.27.93:554/Streaming/Channels/101"
+
+	result, err := streams.ProbeStream(models.StreamProbeRequest{URL: camera, Username: "admin", Password: "secret", TimeoutSeconds: 1})
+	if err != nil {
+		t.Fatalf("probe of a LAN camera refused: %v", err)
+	}
+	if result == nil {
+		t.Fatal("probe returned no result")
+	}
+
+	_, err = streams.CreateStream(testActor, models.StreamRequest{URL: camera}, true)
+	var probeErr *ProbeFailedError
+	if errors.Is(err, ErrSourceNotAllowed) || err != nil && !errors.As(err, &probeErr) {
+		t.Errorf("create with require_probe = %v, want the probe to run", err)
+	}
+
+	if _, err := streams.ProbeStream(models.StreamProbeRequest{URL: "http://192.168.27.93/"}); !errors.Is(err, ErrInvalidProbeURL) {
+		t.Errorf("probe of an http url = %v, want %v", err, ErrInvalidProbeURL)
+	}
+}
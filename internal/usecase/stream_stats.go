@@ -0,0 +1,168 @@
+package usecase
+
+import (
+	"sort"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
+	"github.com/DaffaJatmiko/stream_camera/pkg/webrtc"
+)
+
+// GetStreamStats reports the worker state of a stream. Streams that are not
+// loaded are reported offline.
+func (u *streamUseCase) GetStreamStats(uuid string) (*models.StreamStats, error) {
+	stats := &models.StreamStats{UUID: uuid, Codecs: []string{}, Quality: models.ViewerQuality{Connections: map[string]int{}}}
+
+	runtime, loaded := u.cfg.GetStreamStats(uuid)
+	if !loaded {
+		if _, err := u.streamRepo.GetByUUID(uuid); err != nil {
+			return nil, err
+		}
+		return stats, nil
+	}
+
+	stats.Online = runtime.Online
+	stats.Viewers = runtime.Viewers
+	stats.RelayedViewers = runtime.RelayedViewers
+	for _, codec := range runtime.Codecs {
+		stats.Codecs = append(stats.Codecs, codec.Type().String())
+	}
+	stats.KeyframeRequests = models.KeyframeRequestStats{
+		Received:  runtime.KeyframeRequests,
+		Coalesced: runtime.KeyframeRequestsCoalesced,
+		Replays:   runtime.KeyframeReplays,
+	}
+	if !runtime.LastKeyframeRequest.IsZero() {
+		stats.KeyframeRequests.Last = &runtime.LastKeyframeRequest
+	}
+	for _, conn := range runtime.Connections {
+		addViewerQuality(&stats.Quality, conn)
+	}
+	if stats.Quality.Viewers > 0 {
+		stats.Quality.AvgRTTMs /= float64(stats.Quality.Viewers)
+	}
+	if stats.Quality.PacketsSent > 0 {
+		stats.Quality.LossRate = float64(stats.Quality.PacketsLost) / float64(stats.Quality.PacketsSent)
+	}
+
+	target := ""
+	if stream, ok := u.cfg.GetStream(uuid); ok {
+		target = stream.AudioTranscode
+	}
+	switch {
+	case runtime.Transcode != nil:
+		t := runtime.Transcode
+		stats.Transcode = &models.TranscodeStats{
+			Target:     target,
+			Active:     true,
+			Source:     t.Source,
+			FramesIn:   t.FramesIn,
+			FramesOut:  t.FramesOut,
+			Errors:     t.Errors,
+			LastError:  t.LastError,
+			CPUTimeMs:  t.CPUTimeMs,
+			CPUPercent: t.CPUPercent,
+			Started:    &t.Started,
+		}
+	case target != "":
+		stats.Transcode = &models.TranscodeStats{Target: target, Error: runtime.TranscodeError}
+	}
+	return stats, nil
+}
+
+// GetViewerStats reports the connection quality of each WebRTC viewer of a
+// stream, ordered by connection time with viewers still connecting first
+func (u *streamUseCase) GetViewerStats(uuid string) ([]models.ViewerStats, error) {
+	viewers := []models.ViewerStats{}
+	runtime, loaded := u.cfg.GetStreamStats(uuid)
+	if !loaded {
+		if _, err := u.streamRepo.GetByUUID(uuid); err != nil {
+			return nil, err
+		}
+		return viewers, nil
+	}
+
+	for id, conn := range runtime.Connections {
+		viewer := models.ViewerStats{
+			ID:           id,
+			RTTMs:        milliseconds(conn.RTT),
+			JitterMs:     milliseconds(conn.Jitter),
+			PacketsSent:  conn.PacketsSent,
+			PacketsLost:  conn.PacketsLost,
+			FractionLost: conn.FractionLost,
+			NACKs:        conn.NACKs,
+			PLIs:         conn.PLIs,
+			FIRs:         conn.FIRs,
+			BitrateKbps:  conn.Bitrate / 1000,
+		}
+		if !conn.Connected.IsZero() {
+			connected := conn.Connected
+			viewer.Connected = &connected
+		}
+		if conn.LocalCandidate != "" {
+			viewer.CandidatePair = &models.CandidatePair{
+				Local:    conn.LocalCandidate,
+				Remote:   conn.RemoteCandidate,
+				Protocol: conn.Protocol,
+				Type:     connectionType(conn),
+			}
+		}
+		viewers = append(viewers, viewer)
+	}
+	sort.Slice(viewers, func(i, j int) bool {
+		a := runtime.Connections[viewers[i].ID].Connected
+		b := runtime.Connections[viewers[j].ID].Connected
+		if !a.Equal(b) {
+			return a.Before(b)
+		}
+		return viewers[i].ID < viewers[j].ID
+	})
+	return viewers, nil
+}
+
+// addViewerQuality adds one viewer's connection to the stream summary;
+// AvgRTTMs holds the sum until the caller divides it
+func addViewerQuality(q *models.ViewerQuality, conn webrtc.Stats) {
+	if conn.LocalCandidate == "" {
+		return
+	}
+	q.Viewers++
+	rtt := milliseconds(conn.RTT)
+	q.AvgRTTMs += rtt
+	if rtt > q.MaxRTTMs {
+		q.MaxRTTMs = rtt
+	}
+	if jitter := milliseconds(conn.Jitter); jitter > q.MaxJitterMs {
+		q.MaxJitterMs = jitter
+	}
+	q.PacketsSent += conn.PacketsSent
+	q.PacketsLost += conn.PacketsLost
+	q.NACKs += uint64(conn.NACKs)
+	q.PLIs += uint64(conn.PLIs)
+	q.BitrateKbps += conn.Bitrate / 1000
+	q.Connections[connectionType(conn)]++
+}
+
+// connectionType names a candidate pair by its least direct end
+func connectionType(conn webrtc.Stats) string {
+	for _, typ := range []string{"relay", "srflx", "prflx"} {
+		if conn.LocalCandidate == typ || conn.RemoteCandidate == typ {
+			return typ
+		}
+	}
+	return "host"
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// KickViewer disconnects a viewer of a stream
+func (u *streamUseCase) KickViewer(actor models.Actor, uuid string, viewerID string) error {
+	if !u.cfg.KickViewer(uuid, viewerID) {
+		return repository.ErrNotFound
+	}
+	u.auditUseCase.Record(actor, models.AuditActionViewerKick, uuid, map[string]string{"viewer": viewerID}, nil)
+	return nil
+}
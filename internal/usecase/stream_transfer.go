@@ -0,0 +1,275 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
+	"github.com/DaffaJatmiko/stream_camera/pkg/credcrypt"
+	"github.com/DaffaJatmiko/stream_camera/pkg/utils"
+)
+
+// ErrCredentialKeyRequired is returned when credentials must be encrypted
+// but neither a passphrase nor the configured credential key is available
+var ErrCredentialKeyRequired = errors.New("a passphrase or server.credential_key is required to export credentials")
+
+// ImportStreams creates, or with Upsert updates by name, one stream per
+// record. Every record is validated on its own and reported in the result.
+func (u *streamUseCase) ImportStreams(actor models.Actor, records []models.StreamRecord, opts models.StreamImportOptions) (*models.StreamImportReport, error) {
+	report := &models.StreamImportReport{
+		DryRun: opts.DryRun,
+		Rows:   make([]models.StreamImportResult, 0, len(records)),
+	}
+	passphrase := u.credentialPassphrase(opts.Passphrase)
+	var opener *credcrypt.Opener
+	seen := make(map[string]int, len(records))
+
+	for i, record := range records {
+		result := models.StreamImportResult{Row: i + 1, Name: record.Name}
+
+		if record.Credentials != "" && opener == nil {
+			var err error
+			if opener, err = credcrypt.NewOpener(passphrase); err != nil {
+				failImportRow(report, result, errors.New("record has encrypted credentials but no passphrase was given"))
+				continue
+			}
+		}
+		stream, err := recordToStream(record, opener)
+		if err == nil {
+			err = validateStream(stream)
+		}
+		if err != nil {
+			failImportRow(report, result, err)
+			continue
+		}
+		if record.Name != "" {
+			if first, ok := seen[record.Name]; ok {
+				failImportRow(report, result, fmt.Errorf("name %q already used by row %d", record.Name, first))
+				continue
+			}
+			seen[record.Name] = result.Row
+		}
+
+		existing, err := u.findStreamByName(stream.Name)
+		if err != nil {
+			failImportRow(report, result, err)
+			continue
+		}
+		if existing != nil && !opts.Upsert {
+			failImportRow(report, result, fmt.Errorf("stream %q already exists", record.Name))
+			continue
+		}
+
+		if existing == nil {
+			result.Status = models.StreamImportCreated
+			if !opts.DryRun {
+				stream.UUID = utils.GenerateUUID()
+				if err := u.streamRepo.Create(stream); err != nil {
+					failImportRow(report, result, err)
+					continue
+				}
+				u.auditUseCase.Record(actor, models.AuditActionStreamCreate, stream.UUID, nil, stream)
+				result.UUID = stream.UUID
+			}
+			report.Created++
+		} else {
+			result.Status = models.StreamImportUpdated
+			result.UUID = existing.UUID
+			if !opts.DryRun {
+				before := *existing
+				copyStreamFields(existing, stream)
+				if err := u.streamRepo.Update(existing); err != nil {
+					failImportRow(report, result, err)
+					continue
+				}
+				u.auditUseCase.Record(actor, models.AuditActionStreamUpdate, existing.UUID, &before, existing)
+			}
+			report.Updated++
+		}
+		report.Rows = append(report.Rows, result)
+	}
+	return report, nil
+}
+
+// ExportStreams dumps every stream except ephemeral ones. User info is
+// always removed from the URLs; with includeCredentials it is encrypted
+// into the record's Credentials field.
+func (u *streamUseCase) ExportStreams(includeCredentials bool, passphrase string) (*models.StreamInventory, error) {
+	var sealer *credcrypt.Sealer
+	if includeCredentials {
+		var err error
+		if sealer, err = credcrypt.NewSealer(u.credentialPassphrase(passphrase)); err != nil {
+			if errors.Is(err, credcrypt.ErrNoPassphrase) {
+				return nil, ErrCredentialKeyRequired
+			}
+			return nil, err
+		}
+	}
+
+	streams, _, _, err := u.streamRepo.List(models.StreamFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	inventory := &models.StreamInventory{
+		Version:    models.StreamInventoryVersion,
+		ExportedAt: time.Now().UTC(),
+		Streams:    make([]models.StreamRecord, 0, len(streams)),
+	}
+	for _, stream := range streams {
+		if stream.Ephemeral {
+			continue
+		}
+		record := streamToRecord(stream)
+		var userinfo string
+		record.URL, userinfo = splitUserinfo(stream.URL)
+		if sealer != nil && userinfo != "" {
+			if record.Credentials, err = sealer.Seal(userinfo); err != nil {
+				return nil, err
+			}
+		}
+		inventory.Streams = append(inventory.Streams, record)
+	}
+	return inventory, nil
+}
+
+func (u *streamUseCase) credentialPassphrase(passphrase string) string {
+	if passphrase != "" {
+		return passphrase
+	}
+	return u.cfg.GetCredentialKey()
+}
+
+// findStreamByName returns the live stream called name, or nil
+func (u *streamUseCase) findStreamByName(name *string) (*models.Stream, error) {
+	if name == nil {
+		return nil, nil
+	}
+	stream, err := u.streamRepo.GetByName(*name)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	return stream, err
+}
+
+func failImportRow(report *models.StreamImportReport, result models.StreamImportResult, err error) {
+	result.Status = models.StreamImportFailed
+	result.Error = err.Error()
+	report.Failed++
+	report.Rows = append(report.Rows, result)
+}
+
+func recordToStream(record models.StreamRecord, opener *credcrypt.Opener) (*models.Stream, error) {
+	if strings.TrimSpace(record.URL) == "" {
+		return nil, errors.New("url is required")
+	}
+	stream := &models.Stream{
+		DisplayName:    record.DisplayName,
+		Description:    record.Description,
+		Site:           record.Site,
+		Group:          record.Group,
+		Latitude:       record.Latitude,
+		Longitude:      record.Longitude,
+		Tags:           record.Tags,
+		Metadata:       record.Metadata,
+		URL:            record.URL,
+		OnDemand:       record.OnDemand,
+		Debug:          record.Debug,
+		DisableAudio:   record.DisableAudio,
+		AudioTranscode: record.AudioTranscode,
+		Backchannel:    record.Backchannel,
+	}
+	if record.Name != "" {
+		name := record.Name
+		stream.Name = &name
+	}
+	if record.Credentials != "" {
+		userinfo, err := opener.Open(record.Credentials)
+		if err != nil {
+			return nil, err
+		}
+		if stream.URL, err = joinUserinfo(record.URL, userinfo); err != nil {
+			return nil, err
+		}
+	}
+	return stream, nil
+}
+
+func streamToRecord(stream models.Stream) models.StreamRecord {
+	record := models.StreamRecord{
+		DisplayName:    stream.DisplayName,
+		Description:    stream.Description,
+		Site:           stream.Site,
+		Group:          stream.Group,
+		Latitude:       stream.Latitude,
+		Longitude:      stream.Longitude,
+		Tags:           stream.Tags,
+		Metadata:       stream.Metadata,
+		URL:            stream.URL,
+		OnDemand:       stream.OnDemand,
+		Debug:          stream.Debug,
+		DisableAudio:   stream.DisableAudio,
+		AudioTranscode: stream.AudioTranscode,
+		Backchannel:    stream.Backchannel,
+	}
+	if stream.Name != nil {
+		record.Name = *stream.Name
+	}
+	return record
+}
+
+// copyStreamFields copies the user editable fields of src into dst
+func copyStreamFields(dst, src *models.Stream) {
+	dst.Name = src.Name
+	dst.DisplayName = src.DisplayName
+	dst.Description = src.Description
+	dst.Site = src.Site
+	dst.Group = src.Group
+	dst.Latitude = src.Latitude
+	dst.Longitude = src.Longitude
+	dst.Tags = src.Tags
+	dst.Metadata = src.Metadata
+	dst.URL = src.URL
+	dst.OnDemand = src.OnDemand
+	dst.Debug = src.Debug
+	dst.DisableAudio = src.DisableAudio
+	dst.AudioTranscode = src.AudioTranscode
+	dst.Backchannel = src.Backchannel
+}
+
+// splitUserinfo removes the escaped user info from rawURL. URLs that do not
+// parse are returned unchanged.
+func splitUserinfo(rawURL string) (string, string) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.User == nil {
+		return rawURL, ""
+	}
+	userinfo := parsed.User.String()
+	parsed.User = nil
+	return parsed.String(), userinfo
+}
+
+// joinUserinfo puts escaped user info produced by splitUserinfo back into rawURL
+func joinUserinfo(rawURL, userinfo string) (string, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid url: %w", err)
+	}
+	username, password, hasPassword := strings.Cut(userinfo, ":")
+	if username, err = url.PathUnescape(username); err != nil {
+		return "", credcrypt.ErrMalformed
+	}
+	if !hasPassword {
+		parsed.User = url.User(username)
+		return parsed.String(), nil
+	}
+	if password, err = url.PathUnescape(password); err != nil {
+		return "", credcrypt.ErrMalformed
+	}
+	parsed.User = url.UserPassword(username, password)
+	return parsed.String(), nil
+}
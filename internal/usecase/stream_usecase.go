@@ -1,44 +1,111 @@
 package usecase
 
 import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
 	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
 	"github.com/DaffaJatmiko/stream_camera/internal/repository"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/DaffaJatmiko/stream_camera/pkg/transcode"
 	"github.com/DaffaJatmiko/stream_camera/pkg/utils"
 )
 
+const (
+	defaultStreamPageSize = 50
+	maxStreamPageSize     = 500
+)
+
+// ErrInvalidStreamName is returned for names that are not a valid slug
+var ErrInvalidStreamName = errors.New("stream name must be 1-64 letters, digits, '.', '_' or '-'")
+
+// ErrInvalidStreamLocation is returned for incomplete or out of range coordinates
+var ErrInvalidStreamLocation = errors.New("latitude and longitude must be set together, within [-90, 90] and [-180, 180]")
+
+// ErrInvalidAudioTranscode is returned for an unknown audio transcode target
+var ErrInvalidAudioTranscode = errors.New("audio_transcode must be empty, opus, pcma or pcmu")
+
+// ErrAudioTranscodeUnavailable is returned for an audio transcode target this
+// server was built without the decoder or encoder for
+var ErrAudioTranscodeUnavailable = errors.New("audio_transcode is not available in this build")
+
+var streamNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
 type StreamUseCase interface {
-	GetAllStreams() ([]models.StreamResponse, error)
+	ListStreams(filter models.StreamFilter) (*models.StreamPage, error)
+	GetAllStreams(filter models.StreamFilter) ([]models.StreamResponse, error)
 	GetStream(uuid string) (*models.StreamResponse, error)
-	CreateStream(stream *models.Stream) error
-	UpdateStream(uuid string, stream *models.Stream) error
-	DeleteStream(uuid string) error
+	CreateStream(actor models.Actor, req models.StreamRequest, requireProbe bool) (*models.StreamResponse, error)
+	UpdateStream(actor models.Actor, uuid string, req models.StreamRequest) (*models.StreamResponse, error)
+	DeleteStream(actor models.Actor, uuid string) error
+	GetDeletedStreams() ([]models.StreamResponse, error)
+	RestoreStream(actor models.Actor, uuid string) error
+	PurgeStream(actor models.Actor, uuid string) error
+	ImportStreams(actor models.Actor, records []models.StreamRecord, opts models.StreamImportOptions) (*models.StreamImportReport, error)
+	ExportStreams(includeCredentials bool, passphrase string) (*models.StreamInventory, error)
+	ImportConfigStreams(actor models.Actor, dryRun bool) (*models.StreamImportReport, error)
+	ProbeStream(req models.StreamProbeRequest) (*models.StreamProbeResult, error)
+	GetStreamStats(uuid string) (*models.StreamStats, error)
+	GetViewerStats(uuid string) ([]models.ViewerStats, error)
+	KickViewer(actor models.Actor, uuid string, viewerID string) error
 }
 
 type streamUseCase struct {
-	streamRepo repository.StreamRepository
+	cfg          *config.Config
+	streamRepo   repository.StreamRepository
+	auditUseCase AuditUseCase
 }
 
-func NewStreamUseCase(streamRepo repository.StreamRepository) StreamUseCase {
+func NewStreamUseCase(streamRepo repository.StreamRepository, auditUseCase AuditUseCase) StreamUseCase {
 	return &streamUseCase{
-		streamRepo: streamRepo,
+		cfg:          config.GetInstance(),
+		streamRepo:   streamRepo,
+		auditUseCase: auditUseCase,
 	}
 }
 
-func (u *streamUseCase) GetAllStreams() ([]models.StreamResponse, error) {
-	streams, err := u.streamRepo.GetAll()
+// ListStreams returns one page of the streams matching filter
+func (u *streamUseCase) ListStreams(filter models.StreamFilter) (*models.StreamPage, error) {
+	if filter.Limit < 1 {
+		filter.Limit = defaultStreamPageSize
+	}
+	if filter.Limit > maxStreamPageSize {
+		filter.Limit = maxStreamPageSize
+	}
+
+	live := u.cfg.LiveStreams()
+	filter.LiveUUIDs = live
+	streams, total, next, err := u.streamRepo.List(filter)
 	if err != nil {
 		return nil, err
 	}
 
-	var response []models.StreamResponse
-	for _, stream := range streams {
-		response = append(response, models.StreamResponse{
-			UUID:     stream.UUID,
-			URL:      stream.URL,
-			OnDemand: stream.OnDemand,
-			Debug:    stream.Debug,
-		})
+	page := &models.StreamPage{
+		Items:      toStreamResponses(streams),
+		Total:      total,
+		Limit:      filter.Limit,
+		NextCursor: next,
+	}
+	markLive(page.Items, live)
+	return page, nil
+}
+
+// GetAllStreams returns every stream matching filter, ignoring paging
+func (u *streamUseCase) GetAllStreams(filter models.StreamFilter) ([]models.StreamResponse, error) {
+	filter.Cursor = ""
+	filter.Limit = 0
+
+	live := u.cfg.LiveStreams()
+	filter.LiveUUIDs = live
+	streams, _, _, err := u.streamRepo.List(filter)
+	if err != nil {
+		return nil, err
 	}
+
+	response := toStreamResponses(streams)
+	markLive(response, live)
 	return response, nil
 }
 
@@ -48,32 +115,212 @@ func (u *streamUseCase) GetStream(uuid string) (*models.StreamResponse, error) {
 		return nil, err
 	}
 
-	return &models.StreamResponse{
-		UUID:     stream.UUID,
-		URL:      stream.URL,
-		OnDemand: stream.OnDemand,
-		Debug:    stream.Debug,
-	}, nil
+	response := toStreamResponse(*stream)
+	response.Live = u.cfg.IsStreamOnline(stream.UUID)
+	return &response, nil
 }
 
-func (u *streamUseCase) CreateStream(stream *models.Stream) error {
+// CreateStream stores a new stream. With requireProbe the source must pass
+// a probe first, otherwise a *ProbeFailedError is returned.
+func (u *streamUseCase) CreateStream(actor models.Actor, req models.StreamRequest, requireProbe bool) (*models.StreamResponse, error) {
+	stream := requestToStream(req)
+	if err := validateStream(stream); err != nil {
+		return nil, err
+	}
+	if requireProbe {
+		result, err := u.ProbeStream(models.StreamProbeRequest{URL: stream.URL})
+		if err != nil {
+			return nil, err
+		}
+		if !result.Passed() {
+			return nil, &ProbeFailedError{Result: result}
+		}
+	}
+
 	stream.UUID = utils.GenerateUUID()
-	return u.streamRepo.Create(stream)
+	if err := u.streamRepo.Create(stream); err != nil {
+		return nil, err
+	}
+
+	u.auditUseCase.Record(actor, models.AuditActionStreamCreate, stream.UUID, nil, stream)
+	response := toStreamResponse(*stream)
+	return &response, nil
 }
 
-func (u *streamUseCase) UpdateStream(uuid string, stream *models.Stream) error {
+// UpdateStream replaces the editable fields of a stream. A URL whose
+// password is the redacted placeholder of a response keeps the stored
+// password.
+func (u *streamUseCase) UpdateStream(actor models.Actor, uuid string, req models.StreamRequest) (*models.StreamResponse, error) {
+	stream := requestToStream(req)
+	if err := validateStream(stream); err != nil {
+		return nil, err
+	}
+
 	existingStream, err := u.streamRepo.GetByUUID(uuid)
 	if err != nil {
+		return nil, err
+	}
+	before := *existingStream
+	stream.URL = restoreURLPassword(stream.URL, existingStream.URL)
+
+	copyStreamFields(existingStream, stream)
+
+	if err := u.streamRepo.Update(existingStream); err != nil {
+		return nil, err
+	}
+
+	u.auditUseCase.Record(actor, models.AuditActionStreamUpdate, uuid, &before, existingStream)
+	response := toStreamResponse(*existingStream)
+	return &response, nil
+}
+
+func (u *streamUseCase) DeleteStream(actor models.Actor, uuid string) error {
+	existingStream, err := u.streamRepo.GetByUUID(uuid)
+	if err != nil {
+		return err
+	}
+
+	if err := u.streamRepo.Delete(uuid); err != nil {
+		return err
+	}
+
+	u.auditUseCase.Record(actor, models.AuditActionStreamDelete, uuid, existingStream, nil)
+	return nil
+}
+
+func (u *streamUseCase) GetDeletedStreams() ([]models.StreamResponse, error) {
+	streams, err := u.streamRepo.GetDeleted()
+	if err != nil {
+		return nil, err
+	}
+	return toStreamResponses(streams), nil
+}
+
+func (u *streamUseCase) RestoreStream(actor models.Actor, uuid string) error {
+	if err := u.streamRepo.Restore(uuid); err != nil {
 		return err
 	}
 
-	existingStream.URL = stream.URL
-	existingStream.OnDemand = stream.OnDemand
-	existingStream.Debug = stream.Debug
+	restored, err := u.streamRepo.GetByUUID(uuid)
+	if err != nil {
+		return err
+	}
+	u.auditUseCase.Record(actor, models.AuditActionStreamRestore, uuid, nil, restored)
+	return nil
+}
+
+func (u *streamUseCase) PurgeStream(actor models.Actor, uuid string) error {
+	if err := u.streamRepo.Purge(uuid); err != nil {
+		return err
+	}
+
+	u.auditUseCase.Record(actor, models.AuditActionStreamPurge, uuid, nil, nil)
+	return nil
+}
+
+// requestToStream copies the client editable fields of req into a new stream
+func requestToStream(req models.StreamRequest) *models.Stream {
+	return &models.Stream{
+		Name:           req.Name,
+		DisplayName:    req.DisplayName,
+		Description:    req.Description,
+		Site:           req.Site,
+		Group:          req.Group,
+		Latitude:       req.Latitude,
+		Longitude:      req.Longitude,
+		Tags:           req.Tags,
+		Metadata:       req.Metadata,
+		URL:            req.URL,
+		OnDemand:       req.OnDemand,
+		Debug:          req.Debug,
+		DisableAudio:   req.DisableAudio,
+		AudioTranscode: req.AudioTranscode,
+		Backchannel:    req.Backchannel,
+	}
+}
+
+// validateStream checks the user supplied fields and normalizes the tags
+func validateStream(stream *models.Stream) error {
+	if stream.Name != nil && !streamNamePattern.MatchString(*stream.Name) {
+		return ErrInvalidStreamName
+	}
+	if (stream.Latitude == nil) != (stream.Longitude == nil) {
+		return ErrInvalidStreamLocation
+	}
+	if stream.Latitude != nil && (*stream.Latitude < -90 || *stream.Latitude > 90 ||
+		*stream.Longitude < -180 || *stream.Longitude > 180) {
+		return ErrInvalidStreamLocation
+	}
+	if !transcode.ValidTarget(stream.AudioTranscode) {
+		return ErrInvalidAudioTranscode
+	}
+	if err := transcode.CheckTarget(stream.AudioTranscode); err != nil {
+		return fmt.Errorf("%w: %v", ErrAudioTranscodeUnavailable, err)
+	}
+	stream.Tags = normalizeTags(stream.Tags)
+	return nil
+}
 
-	return u.streamRepo.Update(existingStream)
+// normalizeTags trims tags and drops empty and duplicate entries
+func normalizeTags(tags models.StringList) models.StringList {
+	normalized := make(models.StringList, 0, len(tags))
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	return normalized
 }
 
-func (u *streamUseCase) DeleteStream(uuid string) error {
-	return u.streamRepo.Delete(uuid)
+func toStreamResponse(stream models.Stream) models.StreamResponse {
+	response := models.StreamResponse{
+		UUID:           stream.UUID,
+		Name:           stream.Name,
+		DisplayName:    stream.DisplayName,
+		Description:    stream.Description,
+		Site:           stream.Site,
+		Group:          stream.Group,
+		Latitude:       stream.Latitude,
+		Longitude:      stream.Longitude,
+		Tags:           stream.Tags,
+		Metadata:       stream.Metadata,
+		URL:            redactURLPassword(stream.URL),
+		OnDemand:       stream.OnDemand,
+		Debug:          stream.Debug,
+		DisableAudio:   stream.DisableAudio,
+		AudioTranscode: stream.AudioTranscode,
+		Backchannel:    stream.Backchannel,
+		Ephemeral:      stream.Ephemeral,
+	}
+	if response.Tags == nil {
+		response.Tags = models.StringList{}
+	}
+	if stream.DeletedAt.Valid {
+		deletedAt := stream.DeletedAt.Time
+		response.DeletedAt = &deletedAt
+	}
+	return response
+}
+
+func toStreamResponses(streams []models.Stream) []models.StreamResponse {
+	response := make([]models.StreamResponse, 0, len(streams))
+	for _, stream := range streams {
+		response = append(response, toStreamResponse(stream))
+	}
+	return response
+}
+
+// markLive flags the responses whose stream is in the live set
+func markLive(streams []models.StreamResponse, live []string) {
+	online := make(map[string]bool, len(live))
+	for _, uuid := range live {
+		online[uuid] = true
+	}
+	for i := range streams {
+		streams[i].Live = online[streams[i].UUID]
+	}
 }
@@ -0,0 +1,56 @@
+package usecase
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+)
+
+// relayServerPrincipal names the credentials the server's own peer
+// connections use on the embedded TURN server
+const relayServerPrincipal = "server"
+
+// ErrTURNDisabled is returned when the embedded TURN server is not running
+var ErrTURNDisabled = errors.New("embedded TURN server is disabled")
+
+// GetICEServers returns the ICE servers for a client: the configured STUN
+// servers and, when the embedded TURN server runs and the client is
+// authenticated, short-lived credentials for it issued to the client's name
+func (u *webrtcUseCase) GetICEServers(actor models.Actor) (*models.ICEServers, error) {
+	servers := &models.ICEServers{ICEServers: []models.ICEServer{}}
+	var stun []string
+	for _, url := range u.cfg.GetICEServers() {
+		if strings.HasPrefix(url, "stun:") || strings.HasPrefix(url, "stuns:") {
+			stun = append(stun, url)
+		}
+	}
+	if len(stun) > 0 {
+		servers.ICEServers = append(servers.ICEServers, models.ICEServer{URLs: stun})
+	}
+
+	if u.relay != nil && actor.Authenticated {
+		creds := u.relay.Credentials(actor.Name)
+		servers.ICEServers = append(servers.ICEServers, models.ICEServer{
+			URLs:       creds.URLs,
+			Username:   creds.Username,
+			Credential: creds.Password,
+		})
+		servers.ExpiresAt = &creds.Expires
+	}
+	return servers, nil
+}
+
+// GetTURNStats returns the use of the embedded TURN server
+func (u *webrtcUseCase) GetTURNStats() (*models.TURNStats, error) {
+	if u.relay == nil {
+		return nil, ErrTURNDisabled
+	}
+	stats := u.relay.Stats()
+	return &models.TURNStats{
+		Allocations: stats.Allocations,
+		AuthOK:      stats.AuthOK,
+		AuthFailed:  stats.AuthFailed,
+		PeersDenied: stats.PeersDenied,
+	}, nil
+}
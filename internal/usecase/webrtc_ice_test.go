@@ -0,0 +1,55 @@
+package usecase
+
+import (
+	"testing"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/DaffaJatmiko/stream_camera/pkg/turnserver"
+)
+
+func TestGetICEServersIssuesTURNToAuthenticatedViewers(t *testing.T) {
+	relay, err := turnserver.Start(config.TURNConfig{
+		Listen:        "127.0.0.1:0",
+		PublicIP:      "127.0.0.1",
+		Realm:         "stream_camera",
+		Secret:        "0123456789abcdef",
+		CredentialTTL: config.Duration(time.Hour),
+	}, config.TLSConfig{})
+	if err != nil {
+		t.Fatalf("start turn server: %v", err)
+	}
+	defer relay.Close()
+	u := NewWebRTCUseCase(nil, relay, nil)
+
+	tests := []struct {
+		name     string
+		actor    models.Actor
+		wantTURN bool
+	}{
+		{"anonymous viewer", models.Actor{Name: "anonymous", IP: "198.51.100.7"}, false},
+		{"unverified name", models.Actor{Name: "alice", IP: "198.51.100.7"}, false},
+		{"authenticated viewer", models.Actor{Name: "alice", IP: "198.51.100.7", Authenticated: true}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers, err := u.GetICEServers(tt.actor)
+			if err != nil {
+				t.Fatalf("get ice servers: %v", err)
+			}
+			var turn *models.ICEServer
+			for i := range servers.ICEServers {
+				if servers.ICEServers[i].Username != "" {
+					turn = &servers.ICEServers[i]
+				}
+			}
+			if (turn != nil) != tt.wantTURN {
+				t.Fatalf("turn credentials issued = %v, want %v", turn != nil, tt.wantTURN)
+			}
+			if turn != nil && turn.Username[len(turn.Username)-len(":alice"):] != ":alice" {
+				t.Errorf("turn username = %q, want the viewer's name as principal", turn.Username)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
+	"github.com/DaffaJatmiko/stream_camera/pkg/utils"
+	"github.com/DaffaJatmiko/stream_camera/pkg/webrtc"
+	pionwebrtc "github.com/pion/webrtc/v3"
+)
+
+const (
+	// sessionReconnectTimeout is how long a signaling session waits for an
+	// ICE restart after its connection drops
+	sessionReconnectTimeout = 30 * time.Second
+	// sessionEventBuffer bounds the messages queued for a session's WebSocket
+	sessionEventBuffer = 64
+	// sessionResumeTimeout is how long a session waits to be resumed after
+	// its signaling channel goes away
+	sessionResumeTimeout = 30 * time.Second
+)
+
+// ErrSessionNotFound is returned when resuming a session that has ended, or
+// that the caller may not resume
+var ErrSessionNotFound = errors.New("signaling session not found")
+
+// SignalSession is a viewer of a stream negotiated over a signaling
+// channel. It outlives the channel until its peer connection closes, so a
+// client can resume it after a network change.
+type SignalSession struct {
+	ID       string
+	StreamID string
+
+	owner  models.Actor
+	muxer  *webrtc.Muxer
+	events chan models.SignalMessage
+	done   chan struct{}
+
+	mu          sync.Mutex
+	resumeToken string
+	detached    chan struct{}
+	expiry      *time.Timer
+	expired     bool
+}
+
+// Attach makes the caller the session's signaling channel. It returns the
+// messages to send to the client and a channel that is closed when another
+// signaling channel attaches.
+func (s *SignalSession) Attach() (<-chan models.SignalMessage, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.detached != nil {
+		close(s.detached)
+	}
+	if s.expiry != nil {
+		s.expiry.Stop()
+		s.expiry = nil
+	}
+	s.detached = make(chan struct{})
+	return s.events, s.detached
+}
+
+// Detach releases the signaling channel that attached with detached. The
+// session is closed unless it is resumed within sessionResumeTimeout.
+func (s *SignalSession) Detach(detached <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.detached == nil || (<-chan struct{})(s.detached) != detached {
+		return
+	}
+	s.detached = nil
+	s.expiry = time.AfterFunc(sessionResumeTimeout, func() {
+		s.mu.Lock()
+		if s.expiry == nil {
+			// Resumed meanwhile
+			s.mu.Unlock()
+			return
+		}
+		s.expired = true
+		s.mu.Unlock()
+		log.Printf("[SignalSession] Session %s was not resumed within %v", s.ID, sessionResumeTimeout)
+		s.Close()
+	})
+}
+
+// ResumeToken returns the secret the client resumes the session with
+func (s *SignalSession) ResumeToken() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.resumeToken
+}
+
+// resume checks that actor may take the session over with token and
+// replaces the token, so an earlier one cannot be used again. Sessions of
+// authenticated viewers can only be resumed by the same name.
+func (s *SignalSession) resume(actor models.Actor, token string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.expired || subtle.ConstantTimeCompare([]byte(token), []byte(s.resumeToken)) != 1 {
+		return "", false
+	}
+	if s.owner.Authenticated && (!actor.Authenticated || actor.Name != s.owner.Name) {
+		return "", false
+	}
+	s.resumeToken = newResumeToken()
+	return s.resumeToken, true
+}
+
+// Done is closed when the session ends
+func (s *SignalSession) Done() <-chan struct{} {
+	return s.done
+}
+
+// Restart answers a new offer, typically an ICE restart
+func (s *SignalSession) Restart(sdp64 string) (string, error) {
+	return s.muxer.Restart(sdp64)
+}
+
+// AddCandidate adds a candidate trickled by the client
+func (s *SignalSession) AddCandidate(candidate models.ICECandidate) error {
+	return s.muxer.AddICECandidate(pionwebrtc.ICECandidateInit{
+		Candidate:        candidate.Candidate,
+		SDPMid:           candidate.SDPMid,
+		SDPMLineIndex:    candidate.SDPMLineIndex,
+		UsernameFragment: candidate.UsernameFragment,
+	})
+}
+
+// Close ends the session
+func (s *SignalSession) Close() {
+	s.muxer.Close()
+}
+
+// emit queues a message for the client, dropping it when nobody reads
+func (s *SignalSession) emit(msg models.SignalMessage) {
+	select {
+	case s.events <- msg:
+	default:
+		log.Printf("[SignalSession] Session %s dropped a %s message", s.ID, msg.Type)
+	}
+}
+
+func (s *SignalSession) onICECandidate(candidate *pionwebrtc.ICECandidateInit) {
+	msg := models.SignalMessage{Type: models.SignalCandidate}
+	if candidate != nil {
+		msg.Candidate = &models.ICECandidate{
+			Candidate:        candidate.Candidate,
+			SDPMid:           candidate.SDPMid,
+			SDPMLineIndex:    candidate.SDPMLineIndex,
+			UsernameFragment: candidate.UsernameFragment,
+		}
+	}
+	s.emit(msg)
+}
+
+// StartSession answers the base64 offer of a new trickle ICE session on a
+// stream and starts feeding it
+func (u *webrtcUseCase) StartSession(actor models.Actor, streamID string, sdp64 string) (*SignalSession, string, error) {
+	stream, exists := u.cfg.GetStream(streamID)
+	if !exists {
+		return nil, "", repository.ErrNotFound
+	}
+	u.cfg.StartStreamIfNotRunning(streamID)
+	codecs := u.cfg.GetStreamCodecs(streamID)
+	if codecs == nil {
+		return nil, "", ErrStreamCodecNotFound
+	}
+
+	release, err := u.AcquirePeerConnection(actor.IP)
+	if err != nil {
+		return nil, "", err
+	}
+
+	session := &SignalSession{
+		ID:          utils.GenerateUUID(),
+		StreamID:    streamID,
+		owner:       actor,
+		events:      make(chan models.SignalMessage, sessionEventBuffer),
+		done:        make(chan struct{}),
+		resumeToken: newResumeToken(),
+	}
+	options := u.MuxerOptions(streamID, actor)
+	options.OnICECandidate = session.onICECandidate
+	options.ReconnectTimeout = sessionReconnectTimeout
+	session.muxer = webrtc.NewMuxer(options)
+
+	answer, err := session.muxer.WriteHeader(codecs, sdp64)
+	if err != nil {
+		release()
+		if errors.Is(err, webrtc.ErrorClientCodecUnsupported) {
+			return nil, "", fmt.Errorf("%w: %v", ErrClientCannotPlay, err)
+		}
+		return nil, "", err
+	}
+
+	u.sessionsMu.Lock()
+	u.sessions[session.ID] = session
+	u.sessionsMu.Unlock()
+
+	audioOnly := IsAudioOnly(BuildTracks(codecs, stream.DisableAudio))
+	go func() {
+		defer func() {
+			u.sessionsMu.Lock()
+			delete(u.sessions, session.ID)
+			u.sessionsMu.Unlock()
+			close(session.done)
+			release()
+		}()
+		u.handleStreamConnection(streamID, session.muxer, audioOnly)
+	}()
+
+	log.Printf("[StartSession] Session %s started for stream %s", session.ID, streamID)
+	return session, answer, nil
+}
+
+// ResumeSession returns a running session of a stream for a new signaling
+// channel and the token to resume it with next. The caller must present the
+// session's current resume token and, for sessions started by an
+// authenticated viewer, be that viewer.
+func (u *webrtcUseCase) ResumeSession(actor models.Actor, streamID string, sessionID string, token string) (*SignalSession, string, error) {
+	u.sessionsMu.Lock()
+	session, exists := u.sessions[sessionID]
+	u.sessionsMu.Unlock()
+	if !exists || session.StreamID != streamID {
+		return nil, "", ErrSessionNotFound
+	}
+	next, ok := session.resume(actor, token)
+	if !ok {
+		log.Printf("[ResumeSession] Refused to resume session %s for %s (%s)", sessionID, actor.Name, actor.IP)
+		return nil, "", ErrSessionNotFound
+	}
+	return session, next, nil
+}
+
+// newResumeToken returns a random session resume token
+func newResumeToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
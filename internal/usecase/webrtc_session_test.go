@@ -0,0 +1,78 @@
+package usecase
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+)
+
+func TestResumeSession(t *testing.T) {
+	alice := models.Actor{Name: "alice", IP: "198.51.100.7", Authenticated: true}
+	anonymous := models.Actor{Name: "anonymous", IP: "198.51.100.7"}
+
+	tests := []struct {
+		name     string
+		owner    models.Actor
+		caller   models.Actor
+		streamID string
+		token    string
+		expired  bool
+		wantOK   bool
+	}{
+		{"anonymous viewer on a new network", anonymous, models.Actor{Name: "anonymous", IP: "203.0.113.9"}, "cam", "secret", false, true},
+		{"wrong token", anonymous, anonymous, "cam", "guess", false, false},
+		{"no token", anonymous, anonymous, "cam", "", false, false},
+		{"authenticated owner", alice, alice, "cam", "secret", false, true},
+		{"another operator with the token", alice, models.Actor{Name: "bob", Authenticated: true}, "cam", "secret", false, false},
+		{"anonymous caller on an operator's session", alice, anonymous, "cam", "secret", false, false},
+		{"another stream", anonymous, anonymous, "other", "secret", false, false},
+		{"expired session", anonymous, anonymous, "cam", "secret", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u := NewWebRTCUseCase(nil, nil, nil).(*webrtcUseCase)
+			session := &SignalSession{ID: "session-1", StreamID: "cam", owner: tt.owner, resumeToken: "secret", expired: tt.expired}
+			u.sessions[session.ID] = session
+
+			resumed, next, err := u.ResumeSession(tt.caller, tt.streamID, session.ID, tt.token)
+			if !tt.wantOK {
+				if !errors.Is(err, ErrSessionNotFound) {
+					t.Fatalf("resume error = %v, want %v", err, ErrSessionNotFound)
+				}
+				if session.ResumeToken() != "secret" {
+					t.Error("a refused resume replaced the token")
+				}
+				return
+			}
+			if err != nil || resumed != session {
+				t.Fatalf("resume = %v, %v; want the session", resumed, err)
+			}
+			if next == "" || next == "secret" || session.ResumeToken() != next {
+				t.Errorf("next token = %q, want a new token", next)
+			}
+			if _, _, err := u.ResumeSession(tt.caller, tt.streamID, session.ID, tt.token); !errors.Is(err, ErrSessionNotFound) {
+				t.Errorf("resume with a used token = %v, want %v", err, ErrSessionNotFound)
+			}
+		})
+	}
+}
+
+func TestSessionExpiresAfterDetach(t *testing.T) {
+	session := &SignalSession{ID: "session-1", resumeToken: "secret"}
+	_, first := session.Attach()
+	_, second := session.Attach()
+
+	session.Detach(first)
+	if session.expiry != nil {
+		t.Fatal("a replaced channel started the resume timeout")
+	}
+	session.Detach(second)
+	if session.expiry == nil {
+		t.Fatal("detaching the attached channel did not start the resume timeout")
+	}
+	session.Attach()
+	if session.expiry != nil {
+		t.Error("resuming did not stop the resume timeout")
+	}
+}
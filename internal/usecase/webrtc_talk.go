@@ -0,0 +1,107 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/internal/repository"
+	"github.com/DaffaJatmiko/stream_camera/pkg/backchannel"
+	"github.com/DaffaJatmiko/stream_camera/pkg/transcode"
+	"github.com/DaffaJatmiko/stream_camera/pkg/webrtc"
+	"github.com/deepch/vdk/av"
+)
+
+var (
+	// ErrTalkBusy is returned when another operator is talking to the camera
+	ErrTalkBusy = errors.New("another operator is talking to the camera")
+	// ErrTalkCodec is returned for microphone audio in a codec that cannot
+	// be converted to G.711
+	ErrTalkCodec = errors.New("microphone codec is not supported")
+)
+
+// talkHandler returns the muxer's OnAudio for a viewer of a stream, or nil
+// when the stream has no backchannel or the viewer is not authenticated, so
+// that their microphone is not accepted. Only backchannel operators are
+// heard.
+func (u *webrtcUseCase) talkHandler(streamID string, actor models.Actor) func(*webrtc.AudioTrack) {
+	stream, exists := u.cfg.GetStream(streamID)
+	if !exists || !stream.Backchannel || !actor.Authenticated {
+		return nil
+	}
+	if !u.cfg.IsBackchannelOperator(actor.Name) {
+		return func(*webrtc.AudioTrack) {
+			log.Printf("[talk] Ignoring microphone of %s (%s) on stream %s: not a backchannel operator", actor.Name, actor.IP, streamID)
+		}
+	}
+	return func(track *webrtc.AudioTrack) {
+		if err := u.talk(streamID, actor, track); err != nil {
+			log.Printf("[talk] %s on stream %s: %v", actor.Name, streamID, err)
+		}
+	}
+}
+
+// talk sends the operator's microphone to the camera until either hangs up
+func (u *webrtcUseCase) talk(streamID string, actor models.Actor, track *webrtc.AudioTrack) error {
+	if track.Codec() == nil || !transcode.CanDecode(track.Codec().Type()) {
+		return ErrTalkCodec
+	}
+
+	u.talkersMu.Lock()
+	if talker, busy := u.talkers[streamID]; busy {
+		u.talkersMu.Unlock()
+		return fmt.Errorf("%w: %s", ErrTalkBusy, talker)
+	}
+	u.talkers[streamID] = actor.Name
+	u.talkersMu.Unlock()
+	defer func() {
+		u.talkersMu.Lock()
+		delete(u.talkers, streamID)
+		u.talkersMu.Unlock()
+	}()
+
+	stream, exists := u.cfg.GetStream(streamID)
+	if !exists {
+		return repository.ErrNotFound
+	}
+	workerCfg := u.cfg.GetWorker()
+	conn, err := backchannel.Dial(backchannel.Options{
+		URL:              stream.URL,
+		DialTimeout:      workerCfg.DialTimeout.Duration(),
+		ReadWriteTimeout: workerCfg.ReadWriteTimeout.Duration(),
+	})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	target := transcode.TargetPCMA
+	if conn.Codec().Type() == av.PCM_MULAW {
+		target = transcode.TargetPCMU
+	}
+	transcoder, err := transcode.Convert(track.Codec(), target)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrTalkCodec, err)
+	}
+	defer transcoder.Close()
+
+	log.Printf("[talk] %s is talking to stream %s (%v to %s)", actor.Name, streamID, track.Codec().Type(), target)
+	defer log.Printf("[talk] %s stopped talking to stream %s", actor.Name, streamID)
+	for {
+		pkt, err := track.ReadPacket()
+		if err != nil {
+			// The viewer hung up
+			return nil
+		}
+		packets, err := transcoder.Transcode(pkt)
+		if err != nil {
+			continue
+		}
+		for _, packet := range packets {
+			if err := conn.WritePacket(packet); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package usecase
+
+import (
+	"testing"
+
+	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+)
+
+func TestTalkHandler(t *testing.T) {
+	cfg := &config.Config{
+		Server:  config.ServerConfig{BackchannelOperators: []string{"alice"}},
+		Streams: make(map[string]config.StreamConfig),
+	}
+	cfg.AddStream("door", config.StreamConfig{URL: "rtsp://192.0.2.10/door", Backchannel: true})
+	cfg.AddStream("yard", config.StreamConfig{URL: "rtsp://192.0.2.11/yard"})
+	u := &webrtcUseCase{cfg: cfg, talkers: make(map[string]string)}
+
+	tests := []struct {
+		name        string
+		streamID    string
+		actor       models.Actor
+		wantHandler bool
+		// operator is false when the handler only logs the refusal
+		operator bool
+	}{
+		{"unauthenticated viewer", "door", models.Actor{Name: "anonymous", IP: "198.51.100.7"}, false, false},
+		{"unauthenticated operator name", "door", models.Actor{Name: "alice", IP: "198.51.100.7"}, false, false},
+		{"authenticated operator", "door", models.Actor{Name: "alice", IP: "198.51.100.7", Authenticated: true}, true, true},
+		{"authenticated non-operator", "door", models.Actor{Name: "bob", IP: "198.51.100.7", Authenticated: true}, true, false},
+		{"stream without backchannel", "yard", models.Actor{Name: "alice", IP: "198.51.100.7", Authenticated: true}, false, false},
+		{"unknown stream", "gate", models.Actor{Name: "alice", IP: "198.51.100.7", Authenticated: true}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := u.talkHandler(tt.streamID, tt.actor)
+			if (handler != nil) != tt.wantHandler {
+				t.Fatalf("microphone handler = %v, want %v", handler != nil, tt.wantHandler)
+			}
+			if handler != nil && !tt.operator {
+				handler(nil)
+				if talker, busy := u.talkers[tt.streamID]; busy {
+					t.Errorf("%s took the backchannel without being an operator", talker)
+				}
+			}
+		})
+	}
+}
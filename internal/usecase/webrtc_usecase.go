@@ -1,25 +1,66 @@
 package usecase
 
 import (
+	"encoding/base64"
 	"errors"
+	"fmt"
 	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
 	"log"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/DaffaJatmiko/stream_camera/internal/repository"
 	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/DaffaJatmiko/stream_camera/pkg/ratelimit"
+	"github.com/DaffaJatmiko/stream_camera/pkg/turnserver"
+	"github.com/DaffaJatmiko/stream_camera/pkg/utils"
+	"github.com/DaffaJatmiko/stream_camera/pkg/webrtc"
 	"github.com/deepch/vdk/av"
-	webrtc "github.com/deepch/vdk/format/webrtcv3"
+	pionwebrtc "github.com/pion/webrtc/v3"
+)
+
+var (
+	// ErrTooManyPeerConnections is returned when a client already holds the
+	// maximum number of concurrent peer connections
+	ErrTooManyPeerConnections = errors.New("too many concurrent peer connections")
+	// ErrStreamCodecNotFound is returned when the source has not reported its codecs
+	ErrStreamCodecNotFound = errors.New("stream codec not found")
+	// ErrClientCannotPlay is returned when a client cannot decode the
+	// stream's video codec
+	ErrClientCannotPlay = errors.New("client cannot play the stream's video codec")
+	// ErrNoClientCapabilities is returned when a negotiation request lists
+	// neither codecs nor an offer
+	ErrNoClientCapabilities = errors.New("codecs or sdp64 is required")
+	// ErrInvalidOffer is returned for an offer that is not valid base64
+	ErrInvalidOffer = errors.New("sdp64 is not valid base64")
 )
 
 // WebRTCUseCase defines the interface for WebRTC operations
 type WebRTCUseCase interface {
-	HandleWebRTC(url string, sdp64 string) (*WebRTCResponse, error)
+	HandleWebRTC(actor models.Actor, url string, sdp64 string) (*WebRTCResponse, error)
+	AcquirePeerConnection(client string) (release func(), err error)
+	GetStreamTracks(streamID string) ([]models.CodecDescriptor, error)
+	NegotiateCodecs(streamID string, req models.CodecNegotiationRequest) (*models.CodecNegotiation, error)
+	StartSession(actor models.Actor, streamID string, sdp64 string) (*SignalSession, string, error)
+	ResumeSession(actor models.Actor, streamID string, sessionID string, token string) (*SignalSession, string, error)
+	MuxerOptions(streamID string, actor models.Actor) webrtc.Options
+	GetICEServers(actor models.Actor) (*models.ICEServers, error)
+	GetTURNStats() (*models.TURNStats, error)
 }
 
 type webrtcUseCase struct {
-	cfg        *config.Config
-	streamRepo repository.StreamRepository
+	cfg         *config.Config
+	streamRepo  repository.StreamRepository
+	peerLimiter *ratelimit.ConcurrencyLimiter
+	relay       *turnserver.Server // nil when the embedded TURN server is disabled
+	iceMux      *webrtc.ICEMux     // nil when sessions use their own ports
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*SignalSession
+
+	talkersMu sync.Mutex
+	talkers   map[string]string // operator talking to each stream's camera
 }
 
 // WebRTCResponse represents the response structure for WebRTC operations
@@ -28,35 +69,85 @@ type WebRTCResponse struct {
 	Sdp64  string   `json:"sdp64"`
 }
 
-// NewWebRTCUseCase creates a new instance of WebRTCUseCase
-func NewWebRTCUseCase(streamRepo repository.StreamRepository) WebRTCUseCase {
+// NewWebRTCUseCase creates a new instance of WebRTCUseCase. relay is the
+// embedded TURN server and iceMux the shared ICE ports, each nil when
+// disabled.
+func NewWebRTCUseCase(streamRepo repository.StreamRepository, relay *turnserver.Server, iceMux *webrtc.ICEMux) WebRTCUseCase {
+	cfg := config.GetInstance()
 	return &webrtcUseCase{
-		cfg:        config.GetInstance(),
-		streamRepo: streamRepo,
+		cfg:         cfg,
+		streamRepo:  streamRepo,
+		relay:       relay,
+		iceMux:      iceMux,
+		peerLimiter: ratelimit.NewConcurrencyLimiter(cfg.GetRateLimit().MaxPeerConnectionsPerClient),
+		sessions:    make(map[string]*SignalSession),
+		talkers:     make(map[string]string),
+	}
+}
+
+// AcquirePeerConnection reserves one of the client's peer connection slots
+func (u *webrtcUseCase) AcquirePeerConnection(client string) (func(), error) {
+	release, ok := u.peerLimiter.Acquire(client)
+	if !ok {
+		return nil, ErrTooManyPeerConnections
 	}
+	return release, nil
 }
 
 // HandleWebRTC processes a WebRTC connection request
-func (u *webrtcUseCase) HandleWebRTC(url string, sdp64 string) (*WebRTCResponse, error) {
+func (u *webrtcUseCase) HandleWebRTC(actor models.Actor, url string, sdp64 string) (*WebRTCResponse, error) {
+	dialURL, err := checkSourceURL(u.cfg.GetSourcePolicy(), url)
+	if err != nil {
+		log.Printf("[HandleWebRTC] Rejected source for %s: %v", actor.IP, err)
+		return nil, err
+	}
+
+	release, err := u.AcquirePeerConnection(actor.IP)
+	if err != nil {
+		return nil, err
+	}
+
 	// Get or create stream
 	stream, err := u.getOrCreateStream(url)
 	if err != nil {
+		release()
 		return nil, err
 	}
 
+	// Make sure a worker is feeding the stream
+	if !u.cfg.StreamExists(stream.UUID) {
+		u.cfg.AddStream(stream.UUID, config.StreamConfig{
+			URL:            dialURL,
+			Status:         true,
+			OnDemand:       stream.OnDemand,
+			Debug:          stream.Debug,
+			DisableAudio:   stream.DisableAudio,
+			AudioTranscode: stream.AudioTranscode,
+			Backchannel:    stream.Backchannel,
+			Viewers:        make(map[string]config.ViewerConfig),
+		})
+	}
+	u.cfg.StartStreamIfNotRunning(stream.UUID)
+
 	// Get stream codecs
 	codecs := u.cfg.GetStreamCodecs(stream.UUID)
 	if codecs == nil {
-		return nil, errors.New("stream codec not found")
+		release()
+		return nil, ErrStreamCodecNotFound
 	}
 
 	// Setup WebRTC muxer
-	muxerWebRTC := u.createWebRTCMuxer()
+	muxerWebRTC := u.createWebRTCMuxer(stream.UUID, actor)
 
 	// Create answer for WebRTC connection
 	answer, err := muxerWebRTC.WriteHeader(codecs, sdp64)
+	if errors.Is(err, webrtc.ErrorClientCodecUnsupported) {
+		release()
+		return nil, fmt.Errorf("%w: %v", ErrClientCannotPlay, err)
+	}
 	if err != nil {
 		log.Printf("[HandleWebRTC] WriteHeader error: %v", err)
+		release()
 		return nil, err
 	}
 
@@ -66,10 +157,13 @@ func (u *webrtcUseCase) HandleWebRTC(url string, sdp64 string) (*WebRTCResponse,
 	}
 
 	// Process codecs and build tracks
-	response.Tracks = u.buildTracksFromCodecs(codecs)
+	response.Tracks = BuildTracks(codecs, stream.DisableAudio)
 
 	// Start stream handling in background
-	go u.handleStreamConnection(stream.UUID, muxerWebRTC, codecs)
+	go func() {
+		defer release()
+		u.handleStreamConnection(stream.UUID, muxerWebRTC, IsAudioOnly(response.Tracks))
+	}()
 
 	return response, nil
 }
@@ -80,8 +174,10 @@ func (u *webrtcUseCase) getOrCreateStream(url string) (*models.Stream, error) {
 	if err != nil {
 		log.Printf("[getOrCreateStream] Creating new stream for URL: %s", url)
 		stream = &models.Stream{
-			URL:      url,
-			OnDemand: true,
+			UUID:      utils.GenerateUUID(),
+			URL:       url,
+			OnDemand:  true,
+			Ephemeral: true,
 		}
 		err = u.streamRepo.Create(stream)
 		if err != nil {
@@ -93,46 +189,205 @@ func (u *webrtcUseCase) getOrCreateStream(url string) (*models.Stream, error) {
 }
 
 // createWebRTCMuxer creates a new WebRTC muxer with configured options
-func (u *webrtcUseCase) createWebRTCMuxer() *webrtc.Muxer {
-	return webrtc.NewMuxer(webrtc.Options{
+func (u *webrtcUseCase) createWebRTCMuxer(streamID string, actor models.Actor) *webrtc.Muxer {
+	return webrtc.NewMuxer(u.MuxerOptions(streamID, actor))
+}
+
+// MuxerOptions returns the configured muxer options for a viewer of a
+// stream, including credentials for the embedded TURN server and, on
+// streams with a backchannel, the handler of the viewer's microphone
+func (u *webrtcUseCase) MuxerOptions(streamID string, actor models.Actor) webrtc.Options {
+	options := webrtc.Options{
 		ICEServers:    u.cfg.GetICEServers(),
 		ICEUsername:   u.cfg.GetICEUsername(),
 		ICECredential: u.cfg.GetICECredential(),
 		PortMin:       u.cfg.GetWebRTCPortMin(),
 		PortMax:       u.cfg.GetWebRTCPortMax(),
-	})
+		ICECandidates: u.cfg.GetWebRTCPublicIPs(),
+		Mux:           u.iceMux,
+		OnKeyframeRequest: func() {
+			if u.cfg.RequestKeyframe(streamID) {
+				log.Printf("[MuxerOptions] Viewer of stream %s requested a keyframe", streamID)
+			}
+		},
+		OnAudio: u.talkHandler(streamID, actor),
+	}
+	if u.relay != nil {
+		creds := u.relay.Credentials(relayServerPrincipal)
+		options.RelayServers = []pionwebrtc.ICEServer{{
+			URLs:       creds.URLs,
+			Username:   creds.Username,
+			Credential: creds.Password,
+		}}
+	}
+	return options
+}
+
+// GetStreamTracks starts the stream if needed and returns the tracks its
+// viewers will receive
+func (u *webrtcUseCase) GetStreamTracks(streamID string) ([]models.CodecDescriptor, error) {
+	stream, exists := u.cfg.GetStream(streamID)
+	if !exists {
+		return nil, repository.ErrNotFound
+	}
+	u.cfg.StartStreamIfNotRunning(streamID)
+	codecs := u.cfg.GetStreamCodecs(streamID)
+	if codecs == nil {
+		return nil, ErrStreamCodecNotFound
+	}
+	return DeliveredTracks(codecs, stream.DisableAudio), nil
+}
+
+// NegotiateCodecs matches the tracks of a stream against the codecs a client
+// can play and recommends a transport
+func (u *webrtcUseCase) NegotiateCodecs(streamID string, req models.CodecNegotiationRequest) (*models.CodecNegotiation, error) {
+	clientCodecs := req.Codecs
+	if req.Sdp64 != "" {
+		sdp, err := base64.StdEncoding.DecodeString(req.Sdp64)
+		if err != nil {
+			return nil, ErrInvalidOffer
+		}
+		clientCodecs = append(clientCodecs, webrtc.OfferCodecs(string(sdp))...)
+	}
+	if len(clientCodecs) == 0 {
+		return nil, ErrNoClientCapabilities
+	}
+
+	tracks, err := u.GetStreamTracks(streamID)
+	if err != nil {
+		return nil, err
+	}
+	return NegotiateTracks(tracks, clientCodecs), nil
 }
 
-// buildTracksFromCodecs processes codecs and returns track types
-func (u *webrtcUseCase) buildTracksFromCodecs(codecs []av.CodecData) []string {
-	var tracks []string
+// DeliveredTracks describes the tracks that are delivered to WebRTC viewers
+// for the source codecs, in source order
+func DeliveredTracks(codecs []av.CodecData, disableAudio bool) []models.CodecDescriptor {
+	tracks := []models.CodecDescriptor{}
 	for _, codec := range codecs {
-		if !u.isCodecSupported(codec) {
-			log.Printf("[buildTracksFromCodecs] Codec not supported: %v", codec.Type())
+		if !isCodecSupported(codec) {
+			log.Printf("[DeliveredTracks] Codec not supported: %v", codec.Type())
 			continue
 		}
+		if disableAudio && codec.Type().IsAudio() {
+			continue
+		}
+		tracks = append(tracks, describeCodec(codec))
+	}
+	return tracks
+}
 
-		if codec.Type().IsVideo() {
-			tracks = append(tracks, "video")
+// BuildTracks returns the types of the tracks delivered to WebRTC viewers
+func BuildTracks(codecs []av.CodecData, disableAudio bool) []string {
+	tracks := []string{}
+	for _, track := range DeliveredTracks(codecs, disableAudio) {
+		tracks = append(tracks, track.Type)
+	}
+	return tracks
+}
+
+// IsAudioOnly reports whether no video track is delivered
+func IsAudioOnly(tracks []string) bool {
+	for _, track := range tracks {
+		if track == "video" {
+			return false
+		}
+	}
+	return len(tracks) > 0
+}
+
+// NegotiateTracks marks the tracks the client can play. WebRTC is
+// recommended when the client can play the video, or the audio of an
+// audio-only stream; it is the only transport this server offers.
+func NegotiateTracks(tracks []models.CodecDescriptor, clientCodecs []string) *models.CodecNegotiation {
+	playable := make(map[string]bool, len(clientCodecs))
+	for _, name := range clientCodecs {
+		playable[normalizeCodecName(name)] = true
+	}
+
+	result := &models.CodecNegotiation{
+		Tracks:   make([]models.NegotiatedTrack, 0, len(tracks)),
+		Playable: []string{},
+	}
+	var hasVideo, videoOK, audioOK bool
+	for _, track := range tracks {
+		ok := playable[track.Codec]
+		result.Tracks = append(result.Tracks, models.NegotiatedTrack{CodecDescriptor: track, Playable: ok})
+		if ok {
+			result.Playable = append(result.Playable, track.Codec)
+		}
+		if track.Type == "video" {
+			hasVideo = true
+			videoOK = videoOK || ok
 		} else {
-			tracks = append(tracks, "audio")
+			audioOK = audioOK || ok
 		}
 	}
-	return tracks
+
+	switch {
+	case len(tracks) == 0:
+		result.Reason = "the stream has no track that can be delivered"
+	case hasVideo && !videoOK:
+		result.Reason = fmt.Sprintf("%v: %s", ErrClientCannotPlay, videoCodec(tracks))
+	case !hasVideo && !audioOK:
+		result.Reason = "client cannot play the stream's audio codec"
+	default:
+		result.Transport = models.TransportWebRTC
+	}
+	return result
+}
+
+// CheckClientCodecs returns ErrClientCannotPlay when the video track's codec
+// is not among the codecs the client can decode. Audio is not checked since
+// every WebRTC client plays Opus and G.711.
+func CheckClientCodecs(tracks []models.CodecDescriptor, clientCodecs []string) error {
+	for _, track := range NegotiateTracks(tracks, clientCodecs).Tracks {
+		if track.Type == "video" && !track.Playable {
+			return fmt.Errorf("%w: %s", ErrClientCannotPlay, track.Codec)
+		}
+	}
+	return nil
+}
+
+func videoCodec(tracks []models.CodecDescriptor) string {
+	for _, track := range tracks {
+		if track.Type == "video" {
+			return track.Codec
+		}
+	}
+	return ""
+}
+
+// normalizeCodecName maps client and SDP codec names to av codec names.
+// Case and a "video/" or "audio/" prefix are ignored.
+func normalizeCodecName(name string) string {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	name = strings.TrimPrefix(strings.TrimPrefix(name, "VIDEO/"), "AUDIO/")
+	switch name {
+	case "HEVC", "H.265":
+		return "H265"
+	case "AVC", "H.264":
+		return "H264"
+	case "PCMA":
+		return "PCM_ALAW"
+	case "PCMU":
+		return "PCM_MULAW"
+	}
+	return name
 }
 
 // isCodecSupported checks if the codec is supported for WebRTC
-func (u *webrtcUseCase) isCodecSupported(codec av.CodecData) bool {
+func isCodecSupported(codec av.CodecData) bool {
 	return codec.Type() == av.H264 ||
+		codec.Type() == av.H265 ||
 		codec.Type() == av.PCM_ALAW ||
 		codec.Type() == av.PCM_MULAW ||
 		codec.Type() == av.OPUS
 }
 
 // handleStreamConnection manages the WebRTC stream connection
-func (u *webrtcUseCase) handleStreamConnection(streamID string, muxerWebRTC *webrtc.Muxer, codecs []av.CodecData) {
-	isAudioOnly := len(codecs) == 1 && codecs[0].Type().IsAudio()
-	viewerID, packetChannel := u.cfg.AddViewer(streamID)
+func (u *webrtcUseCase) handleStreamConnection(streamID string, muxerWebRTC *webrtc.Muxer, isAudioOnly bool) {
+	viewerID, packetChannel := u.cfg.AddViewer(streamID, muxerWebRTC)
 
 	defer func() {
 		u.cfg.RemoveViewer(streamID, viewerID)
@@ -140,7 +395,8 @@ func (u *webrtcUseCase) handleStreamConnection(streamID string, muxerWebRTC *web
 	}()
 
 	var videoStart bool
-	noVideo := time.NewTimer(10 * time.Second)
+	noVideoTimeout := u.cfg.GetWorker().ViewerNoVideoTimeout.Duration()
+	noVideo := time.NewTimer(noVideoTimeout)
 	defer noVideo.Stop()
 
 	for {
@@ -148,9 +404,17 @@ func (u *webrtcUseCase) handleStreamConnection(streamID string, muxerWebRTC *web
 		case <-noVideo.C:
 			log.Printf("[handleStreamConnection] No video timeout for stream: %s", streamID)
 			return
+		case <-muxerWebRTC.KeyframeRequests():
+			if !videoStart {
+				continue
+			}
+			if err := muxerWebRTC.WriteReplay(u.cfg.ReplayGOP(streamID, viewerID)); err != nil {
+				log.Printf("[handleStreamConnection] WriteReplay error: %v", err)
+				return
+			}
 		case packet := <-packetChannel:
 			if u.shouldStartVideo(packet, isAudioOnly, &videoStart) {
-				noVideo.Reset(10 * time.Second)
+				noVideo.Reset(noVideoTimeout)
 			}
 
 			if !videoStart && !isAudioOnly {
@@ -0,0 +1,73 @@
+// Package auth issues and verifies the bearer tokens that identify
+// operators. A token is "<payload>.<signature>" in unpadded base64url, where
+// the payload is "<expiry unix time>:<name>" and the signature is its
+// HMAC-SHA256 keyed with the configured secret.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for a malformed token or a bad signature
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken is returned for a well signed token past its expiry
+	ErrExpiredToken = errors.New("token expired")
+	// ErrNoSecret is returned when no token secret is configured
+	ErrNoSecret = errors.New("no token secret configured")
+)
+
+var encoding = base64.RawURLEncoding
+
+// Issue returns a token for name, valid until expires
+func Issue(secret string, name string, expires time.Time) (string, error) {
+	if secret == "" {
+		return "", ErrNoSecret
+	}
+	if name == "" {
+		return "", errors.New("token name is empty")
+	}
+	payload := strconv.FormatInt(expires.Unix(), 10) + ":" + name
+	return encoding.EncodeToString([]byte(payload)) + "." + encoding.EncodeToString(sign(secret, payload)), nil
+}
+
+// Verify returns the name a token was issued to
+func Verify(secret string, token string, now time.Time) (string, error) {
+	if secret == "" {
+		return "", ErrNoSecret
+	}
+	encodedPayload, encodedSignature, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidToken
+	}
+	payload, err := encoding.DecodeString(encodedPayload)
+	if err != nil {
+		return "", ErrInvalidToken
+	}
+	signature, err := encoding.DecodeString(encodedSignature)
+	if err != nil || !hmac.Equal(signature, sign(secret, string(payload))) {
+		return "", ErrInvalidToken
+	}
+
+	expiry, name, ok := strings.Cut(string(payload), ":")
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if !ok || err != nil || name == "" {
+		return "", ErrInvalidToken
+	}
+	if now.Unix() > unix {
+		return "", ErrExpiredToken
+	}
+	return name, nil
+}
+
+func sign(secret string, payload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,447 @@
+// Package backchannel sends audio to a camera over the RTSP backchannel of
+// the ONVIF Streaming Specification. A DESCRIBE carrying the backchannel
+// Require tag makes the camera list an extra "sendonly" audio media; the
+// client sets it up over TCP, sends PLAY and then writes interleaved RTP.
+package backchannel
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deepch/vdk/av"
+	"github.com/deepch/vdk/codec"
+	"github.com/pion/rtp"
+)
+
+const (
+	// requireBackchannel is the RTSP Require tag of the ONVIF backchannel
+	requireBackchannel = "www.onvif.org/ver20/backchannel"
+	userAgent          = "stream_camera"
+	// defaultSessionTimeout applies when the camera does not state one
+	defaultSessionTimeout = 60 * time.Second
+	g711ClockRate         = 8000
+)
+
+var (
+	// ErrNoBackchannel is returned when the camera lists no backchannel
+	// media, or none in G.711
+	ErrNoBackchannel = errors.New("camera has no G.711 audio backchannel")
+	ErrClosed        = errors.New("backchannel closed")
+)
+
+// Options configures the connection to a camera
+type Options struct {
+	URL              string // rtsp:// URL of the stream, with credentials
+	DialTimeout      time.Duration
+	ReadWriteTimeout time.Duration
+}
+
+// Conn is a playing backchannel session
+type Conn struct {
+	options Options
+	conn    net.Conn
+	reader  *bufio.Reader
+	uri     string // request URI without user info
+	user    *url.Userinfo
+	auth    string // Authorization challenge to answer, once received
+	cseq    int
+	session string
+	timeout time.Duration
+
+	codec       av.AudioCodecData
+	channel     byte // interleaved RTP channel
+	payloadType uint8
+
+	mu        sync.Mutex
+	closed    bool
+	done      chan struct{}
+	packet    rtp.Packet
+	timestamp time.Duration // of the first packet, subtracted from later ones
+	started   bool
+}
+
+// Dial connects to the camera and starts a backchannel session
+func Dial(options Options) (*Conn, error) {
+	u, err := url.Parse(options.URL)
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "554")
+	}
+	netConn, err := net.DialTimeout("tcp", host, options.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{
+		options: options,
+		conn:    netConn,
+		reader:  bufio.NewReader(netConn),
+		user:    u.User,
+		timeout: defaultSessionTimeout,
+		done:    make(chan struct{}),
+		packet: rtp.Packet{Header: rtp.Header{
+			Version:        2,
+			SequenceNumber: uint16(rand.Uint32()),
+			SSRC:           rand.Uint32(),
+		}},
+	}
+	u.User = nil
+	c.uri = u.String()
+
+	if err := c.setup(); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	go c.drain()
+	go c.keepAlive()
+	return c, nil
+}
+
+// setup runs DESCRIBE, SETUP and PLAY
+func (c *Conn) setup() error {
+	res, err := c.request("DESCRIBE", c.uri, map[string]string{"Accept": "application/sdp"})
+	if err != nil {
+		return err
+	}
+	base := c.uri
+	if contentBase := res.header["content-base"]; contentBase != "" {
+		base = contentBase
+	}
+	control, err := c.parseSDP(string(res.body), base)
+	if err != nil {
+		return err
+	}
+
+	res, err = c.request("SETUP", control, map[string]string{
+		"Transport": "RTP/AVP/TCP;unicast;interleaved=0-1",
+	})
+	if err != nil {
+		return err
+	}
+	session, params, _ := strings.Cut(res.header["session"], ";")
+	c.session = strings.TrimSpace(session)
+	for _, param := range strings.Split(params, ";") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(param), "timeout="); ok {
+			if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+				c.timeout = time.Duration(seconds) * time.Second
+			}
+		}
+	}
+	if transport := res.header["transport"]; transport != "" {
+		for _, param := range strings.Split(transport, ";") {
+			if value, ok := strings.CutPrefix(param, "interleaved="); ok {
+				first, _, _ := strings.Cut(value, "-")
+				if channel, err := strconv.Atoi(first); err == nil {
+					c.channel = byte(channel)
+				}
+			}
+		}
+	}
+
+	_, err = c.request("PLAY", c.uri, map[string]string{"Range": "npt=0.000-"})
+	return err
+}
+
+// parseSDP finds the backchannel media and returns its control URL
+func (c *Conn) parseSDP(sdp string, base string) (string, error) {
+	for _, media := range strings.Split(sdp, "\nm=")[1:] {
+		lines := strings.Split(media, "\n")
+		fields := strings.Fields(lines[0])
+		if len(fields) < 4 || fields[0] != "audio" {
+			continue
+		}
+		var control string
+		sendonly := false
+		rtpmap := map[string]string{}
+		for _, line := range lines[1:] {
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "a=sendonly":
+				sendonly = true
+			case strings.HasPrefix(line, "a=control:"):
+				control = strings.TrimPrefix(line, "a=control:")
+			case strings.HasPrefix(line, "a=rtpmap:"):
+				pt, encoding, _ := strings.Cut(strings.TrimPrefix(line, "a=rtpmap:"), " ")
+				name, _, _ := strings.Cut(encoding, "/")
+				rtpmap[pt] = strings.ToUpper(name)
+			}
+		}
+		if !sendonly {
+			continue
+		}
+		for _, pt := range fields[3:] {
+			name := rtpmap[pt]
+			switch {
+			case pt == "0" || name == "PCMU":
+				c.codec = codec.NewPCMMulawCodecData()
+			case pt == "8" || name == "PCMA":
+				c.codec = codec.NewPCMAlawCodecData()
+			default:
+				continue
+			}
+			payloadType, _ := strconv.Atoi(pt)
+			c.payloadType = uint8(payloadType)
+			return resolveControl(base, control), nil
+		}
+	}
+	return "", ErrNoBackchannel
+}
+
+func resolveControl(base string, control string) string {
+	if control == "" || control == "*" {
+		return base
+	}
+	if strings.HasPrefix(control, "rtsp://") || strings.HasPrefix(control, "rtsps://") {
+		return control
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(control, "/")
+}
+
+// Codec returns the codec the camera accepts, A-law or µ-law
+func (c *Conn) Codec() av.AudioCodecData {
+	return c.codec
+}
+
+// WritePacket sends one packet of G.711 audio in the camera's codec
+func (c *Conn) WritePacket(pkt av.Packet) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return ErrClosed
+	}
+	if !c.started {
+		c.started = true
+		c.timestamp = pkt.Time
+	}
+	c.packet.PayloadType = c.payloadType
+	c.packet.Timestamp = uint32((pkt.Time - c.timestamp) * g711ClockRate / time.Second)
+	c.packet.Payload = pkt.Data
+	c.packet.SequenceNumber++
+	payload, err := c.packet.Marshal()
+	if err != nil {
+		return err
+	}
+
+	frame := make([]byte, 4+len(payload))
+	frame[0] = '$'
+	frame[1] = c.channel
+	frame[2] = byte(len(payload) >> 8)
+	frame[3] = byte(len(payload))
+	copy(frame[4:], payload)
+	c.conn.SetWriteDeadline(time.Now().Add(c.options.ReadWriteTimeout))
+	_, err = c.conn.Write(frame)
+	return err
+}
+
+// Done is closed when the session ends
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close ends the session
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.conn.SetWriteDeadline(time.Now().Add(c.options.ReadWriteTimeout))
+	_, err := c.conn.Write(c.encodeRequest("TEARDOWN", c.uri, nil))
+	c.conn.SetReadDeadline(time.Now().Add(c.options.ReadWriteTimeout))
+	c.mu.Unlock()
+	if err == nil {
+		// Let drain read the reply, so the camera is not reset mid-write
+		<-c.done
+	}
+	return c.conn.Close()
+}
+
+// keepAlive refreshes the session before the camera times it out
+func (c *Conn) keepAlive() {
+	ticker := time.NewTicker(c.timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.mu.Lock()
+			if !c.closed {
+				c.conn.SetWriteDeadline(time.Now().Add(c.options.ReadWriteTimeout))
+				c.conn.Write(c.encodeRequest("GET_PARAMETER", c.uri, nil))
+			}
+			c.mu.Unlock()
+		}
+	}
+}
+
+// drain discards what the camera sends after PLAY: RTCP and the replies to
+// keep-alives
+func (c *Conn) drain() {
+	defer close(c.done)
+	defer c.conn.Close()
+	for {
+		c.mu.Lock()
+		// Once closed, the deadline Close set for the TEARDOWN reply stands
+		if !c.closed {
+			c.conn.SetReadDeadline(time.Now().Add(c.timeout + c.options.ReadWriteTimeout))
+		}
+		c.mu.Unlock()
+		first, err := c.reader.Peek(1)
+		if err != nil {
+			return
+		}
+		if first[0] == '$' {
+			header := make([]byte, 4)
+			if _, err := io.ReadFull(c.reader, header); err != nil {
+				return
+			}
+			if _, err := c.reader.Discard(int(header[2])<<8 | int(header[3])); err != nil {
+				return
+			}
+			continue
+		}
+		if _, err := c.readResponse(); err != nil {
+			return
+		}
+		c.mu.Lock()
+		closed := c.closed
+		c.mu.Unlock()
+		if closed {
+			return
+		}
+	}
+}
+
+type response struct {
+	status int
+	header map[string]string // lower case names
+	body   []byte
+}
+
+// request sends a request and reads its response, answering an
+// authentication challenge once
+func (c *Conn) request(method string, uri string, header map[string]string) (*response, error) {
+	for attempt := 0; ; attempt++ {
+		c.conn.SetDeadline(time.Now().Add(c.options.ReadWriteTimeout))
+		if _, err := c.conn.Write(c.encodeRequest(method, uri, header)); err != nil {
+			return nil, err
+		}
+		res, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		if res.status == 401 && attempt == 0 && c.user != nil {
+			c.auth = res.header["www-authenticate"]
+			continue
+		}
+		if res.status != 200 {
+			return nil, fmt.Errorf("backchannel %s: RTSP status %d", method, res.status)
+		}
+		return res, nil
+	}
+}
+
+func (c *Conn) encodeRequest(method string, uri string, header map[string]string) []byte {
+	c.cseq++
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s RTSP/1.0\r\n", method, uri)
+	fmt.Fprintf(&b, "CSeq: %d\r\n", c.cseq)
+	fmt.Fprintf(&b, "User-Agent: %s\r\n", userAgent)
+	fmt.Fprintf(&b, "Require: %s\r\n", requireBackchannel)
+	if c.session != "" {
+		fmt.Fprintf(&b, "Session: %s\r\n", c.session)
+	}
+	if authorization := c.authorization(method, uri); authorization != "" {
+		fmt.Fprintf(&b, "Authorization: %s\r\n", authorization)
+	}
+	for name, value := range header {
+		fmt.Fprintf(&b, "%s: %s\r\n", name, value)
+	}
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+func (c *Conn) readResponse() (*response, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "RTSP/") {
+		return nil, fmt.Errorf("backchannel: malformed response %q", strings.TrimSpace(line))
+	}
+	res := &response{header: map[string]string{}}
+	if res.status, err = strconv.Atoi(fields[1]); err != nil {
+		return nil, fmt.Errorf("backchannel: malformed status %q", fields[1])
+	}
+	for {
+		line, err := c.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, _ := strings.Cut(line, ":")
+		name = strings.ToLower(strings.TrimSpace(name))
+		// Keep the first Digest challenge when several are offered
+		if _, seen := res.header[name]; seen && name == "www-authenticate" {
+			continue
+		}
+		res.header[name] = strings.TrimSpace(value)
+	}
+	if length, _ := strconv.Atoi(res.header["content-length"]); length > 0 {
+		res.body = make([]byte, length)
+		if _, err := io.ReadFull(c.reader, res.body); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// authorization answers the last challenge with Basic or Digest credentials
+func (c *Conn) authorization(method string, uri string) string {
+	if c.auth == "" || c.user == nil {
+		return ""
+	}
+	username := c.user.Username()
+	password, _ := c.user.Password()
+	scheme, params, _ := strings.Cut(c.auth, " ")
+	if strings.EqualFold(scheme, "Basic") {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+
+	values := map[string]string{}
+	for _, param := range strings.Split(params, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		values[strings.ToLower(name)] = strings.Trim(value, `"`)
+	}
+	realm, nonce := values["realm"], values["nonce"]
+	ha1 := md5Hex(username + ":" + realm + ":" + password)
+	ha2 := md5Hex(method + ":" + uri)
+	return fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s", response="%s"`,
+		username, realm, nonce, uri, md5Hex(ha1+":"+nonce+":"+ha2))
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,66 @@
+package certreload
+
+import (
+	"crypto/tls"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/filewatch"
+)
+
+// pollInterval is how often the certificate files are checked for changes
+const pollInterval = 10 * time.Second
+
+// Reloader serves a TLS certificate and reloads it when the files change
+type Reloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	watcher  *filewatch.Watcher
+}
+
+// New loads the key pair and starts watching both files for changes
+func New(certFile, keyFile string) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	r.watcher = filewatch.New(pollInterval, r.onChange, certFile, keyFile)
+	r.watcher.Start()
+	return r, nil
+}
+
+// GetCertificate implements tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// Close stops watching the certificate files
+func (r *Reloader) Close() {
+	r.watcher.Stop()
+}
+
+func (r *Reloader) onChange() {
+	// The previous certificate stays in use if the new pair is incomplete,
+	// e.g. when the cert was replaced before the key.
+	if err := r.reload(); err != nil {
+		log.Printf("[TLS] Keeping previous certificate, reload failed: %v", err)
+		return
+	}
+	log.Printf("[TLS] Reloaded certificate from %s", r.certFile)
+}
+
+func (r *Reloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.cert = &cert
+	r.mu.Unlock()
+	return nil
+}
@@ -2,14 +2,16 @@
 package config
 
 import (
-	"encoding/json"
-	"flag"
-	"io/ioutil"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/DaffaJatmiko/stream_camera/pkg/transcode"
 	"github.com/DaffaJatmiko/stream_camera/pkg/utils"
+	"github.com/DaffaJatmiko/stream_camera/pkg/webrtc"
 	"github.com/deepch/vdk/av"
 	"github.com/deepch/vdk/format/rtspv2"
 )
@@ -19,20 +21,169 @@ var (
 	once     sync.Once
 )
 
+var (
+	errStreamExitNoViewer       = errors.New("stream exit on demand no viewer")
+	errStreamExitRtspDisconnect = errors.New("stream exit rtsp disconnect")
+	errStreamExitStopped        = errors.New("stream exit stopped")
+)
+
 type Config struct {
 	mutex     sync.RWMutex
 	Server    ServerConfig            `json:"server"`
+	Database  DatabaseConfig          `json:"database"`
+	Worker    WorkerConfig            `json:"worker"`
 	Streams   map[string]StreamConfig `json:"streams"`
 	LastError error
+
+	args        []string                // command line the configuration was loaded from
+	path        string                  // resolved config file, empty when none was used
+	envPath     string                  // dotenv file, which may be absent
+	fileStreams map[string]StreamConfig // streams defined in the config file
+}
+
+type DatabaseConfig struct {
+	Driver   string `json:"driver"` // "postgres", "sqlite" or "memory"
+	Path     string `json:"path"`   // database file for the sqlite driver
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+	SSLMode  string `json:"sslmode"`
+	TimeZone string `json:"timezone"`
+	// AutoMigrate applies pending migrations at startup; otherwise the
+	// server refuses to start until "migrate up" has been run
+	AutoMigrate bool `json:"auto_migrate"`
+	// ImportConfigStreams copies the streams of the config file into the
+	// database at startup, skipping URLs that are already stored
+	ImportConfigStreams bool `json:"import_config_streams"`
+}
+
+// DSN returns the PostgreSQL connection string
+func (d DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
+		d.Host, d.User, d.Password, d.Name, d.Port, d.SSLMode, d.TimeZone)
+}
+
+// WorkerConfig holds the RTSP worker and viewer timeouts
+type WorkerConfig struct {
+	DialTimeout          Duration `json:"dial_timeout"`
+	ReadWriteTimeout     Duration `json:"read_write_timeout"`
+	KeyframeTimeout      Duration `json:"keyframe_timeout"`        // restart the source when no keyframe arrives
+	ViewerCheckInterval  Duration `json:"viewer_check_interval"`   // stop on-demand sources without viewers
+	RetryInterval        Duration `json:"retry_interval"`          // delay between reconnects of always-on sources
+	ViewerNoVideoTimeout Duration `json:"viewer_no_video_timeout"` // drop viewers that receive no keyframe
 }
 
 type ServerConfig struct {
-	HTTPPort      string   `json:"http_port"`
-	ICEServers    []string `json:"ice_servers"`
-	ICEUsername   string   `json:"ice_username"`
-	ICECredential string   `json:"ice_credential"`
-	WebRTCPortMin uint16   `json:"webrtc_port_min"`
-	WebRTCPortMax uint16   `json:"webrtc_port_max"`
+	HTTPPort      string             `json:"http_port"`
+	ICEServers    []string           `json:"ice_servers"`
+	ICEUsername   string             `json:"ice_username"`
+	ICECredential string             `json:"ice_credential"`
+	WebRTCPortMin uint16             `json:"webrtc_port_min"`
+	WebRTCPortMax uint16             `json:"webrtc_port_max"`
+	RateLimit     RateLimitConfig    `json:"rate_limit"`
+	SourcePolicy  SourcePolicyConfig `json:"source_policy"`
+	CORS          CORSConfig         `json:"cors"`
+	TLS           TLSConfig          `json:"tls"`
+	TURN          TURNConfig         `json:"turn"`
+	Auth          AuthConfig         `json:"auth"`
+	// CredentialKey encrypts stream credentials in inventory exports when the
+	// client does not supply its own passphrase
+	CredentialKey string `json:"credential_key"`
+	// WebRTCUDPPort, when set, is shared by the host candidates of all
+	// sessions instead of a port per session
+	WebRTCUDPPort uint16 `json:"webrtc_udp_port"`
+	// WebRTCTCPPort, when set, accepts ICE-TCP connections
+	WebRTCTCPPort uint16 `json:"webrtc_tcp_port"`
+	// WebRTCPublicIP is the NAT 1:1 address advertised in host candidates
+	WebRTCPublicIP string `json:"webrtc_public_ip"`
+	// BackchannelOperators are the operators, by token or client certificate
+	// name, allowed to talk to cameras. Nobody can talk when it is empty.
+	BackchannelOperators []string `json:"backchannel_operators"`
+	// TrustedProxies are the reverse proxy addresses or CIDRs whose
+	// X-Forwarded-For is believed. Without any, clients are identified by
+	// the remote address of their connection.
+	TrustedProxies []string `json:"trusted_proxies"`
+}
+
+// TLSConfig enables HTTPS when both CertFile and KeyFile are set
+type TLSConfig struct {
+	CertFile     string `json:"cert_file"`
+	KeyFile      string `json:"key_file"`
+	MinVersion   string `json:"min_version"`    // "1.2" or "1.3"
+	ClientCAFile string `json:"client_ca_file"` // enables client certificate auth
+	ClientAuth   string `json:"client_auth"`    // "request" (verified when given) or "require"/"verify" (default when ClientCAFile is set)
+	RedirectPort string `json:"redirect_port"`  // optional plain HTTP listener redirecting to HTTPS
+}
+
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" && t.KeyFile != ""
+}
+
+// AuthConfig verifies the identity of operators. A request is authenticated
+// by a bearer token signed with TokenSecret or by a TLS client certificate
+// verified against server.tls.client_ca_file; other requests are anonymous.
+type AuthConfig struct {
+	TokenSecret string `json:"token_secret"`
+}
+
+// TURNConfig runs an embedded TURN server for viewers behind restrictive
+// NATs. Clients get short-lived credentials signed with Secret.
+type TURNConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Listen    string `json:"listen"`     // UDP and TCP address
+	TLSListen string `json:"tls_listen"` // TURN over TLS address using server.tls; empty disables it
+	PublicIP  string `json:"public_ip"`  // relay address advertised to peers
+	Host      string `json:"host"`       // host name in turn: URLs, default public_ip
+	Realm     string `json:"realm"`
+	Secret    string `json:"secret"`
+	// CredentialTTL is how long issued credentials are accepted
+	CredentialTTL Duration `json:"credential_ttl"`
+	// RelayPortMin and RelayPortMax bound the relay ports; zero uses any port
+	RelayPortMin uint16 `json:"relay_port_min"`
+	RelayPortMax uint16 `json:"relay_port_max"`
+	// DeniedPeerCIDRs are the peer addresses clients may not relay to, by
+	// default the loopback, private, link-local and multicast ranges
+	DeniedPeerCIDRs []string `json:"denied_peer_cidrs"`
+}
+
+// CORSConfig describes which browser origins besides the server's own may
+// call the API. Origins may contain a leading wildcard subdomain, e.g.
+// "https://*.example.com"; "*" must be listed explicitly to allow any site.
+// With no origins only same-origin pages are served.
+type CORSConfig struct {
+	AllowedOrigins   []string `json:"allowed_origins"`
+	AllowedMethods   []string `json:"allowed_methods"`
+	AllowedHeaders   []string `json:"allowed_headers"`
+	ExposedHeaders   []string `json:"exposed_headers"`
+	AllowCredentials bool     `json:"allow_credentials"`
+	MaxAge           Duration `json:"max_age"`
+}
+
+type RateLimitConfig struct {
+	Signaling                   RateLimitRule `json:"signaling"`
+	API                         RateLimitRule `json:"api"`
+	MaxPeerConnectionsPerClient int           `json:"max_peer_connections_per_client"`
+}
+
+// RateLimitRule limits requests per minute; zero disables the limit
+type RateLimitRule struct {
+	PerIP        float64 `json:"per_ip"`
+	PerPrincipal float64 `json:"per_principal"`
+	Burst        int     `json:"burst"`
+}
+
+// SourcePolicyConfig restricts which source URLs clients may play ad hoc
+// through POST /stream. Empty scheme and port lists allow any value; with no
+// CIDRs, sources resolving to private, loopback or link-local addresses are
+// refused.
+type SourcePolicyConfig struct {
+	DisableURLPlayback   bool     `json:"disable_url_playback"`
+	AllowedSchemes       []string `json:"allowed_schemes"`
+	AllowedCIDRs         []string `json:"allowed_cidrs"`
+	AllowedPorts         []int    `json:"allowed_ports"`
+	EphemeralIdleTimeout Duration `json:"ephemeral_idle_timeout"`
 }
 
 type StreamConfig struct {
@@ -40,65 +191,70 @@ type StreamConfig struct {
 	Status       bool   `json:"status"`
 	OnDemand     bool   `json:"on_demand"`
 	DisableAudio bool   `json:"disable_audio"`
-	Debug        bool   `json:"debug"`
-	RunLock      bool   `json:"-"`
-	Codecs       []av.CodecData
-	Viewers      map[string]ViewerConfig // Renamed from Cl for clarity
+	// AudioTranscode is "opus", "pcma" or "pcmu" to convert audio that
+	// WebRTC cannot carry, or empty to drop it
+	AudioTranscode string                  `json:"audio_transcode"`
+	Backchannel    bool                    `json:"backchannel"` // operators may talk to the camera
+	Debug          bool                    `json:"debug"`
+	RunLock        bool                    `json:"-"`
+	Online         bool                    `json:"-"` // a worker is connected to the source
+	Transcoder     *transcode.Transcoder   `json:"-"` // audio transcoder of the current worker
+	TranscodeError string                  `json:"-"` // why the transcoder could not be created
+	Codecs         []av.CodecData          `json:"-"`
+	Viewers        map[string]ViewerConfig `json:"-"` // Renamed from Cl for clarity
+	LastViewerAt   time.Time               `json:"-"`
+	keyframes      keyframeRequests        // PLI/FIR received from viewers
+	gop            []av.Packet             // video packets since the last keyframe
+	stop           chan struct{}           // closed when the stream is removed or replaced
+}
+
+// withRuntimeState initialises the runtime fields of a stream entry
+func (s StreamConfig) withRuntimeState() StreamConfig {
+	if s.Viewers == nil {
+		s.Viewers = make(map[string]ViewerConfig)
+	}
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+	return s
+}
+
+// sameSource reports whether two stream entries describe the same source
+func (s StreamConfig) sameSource(other StreamConfig) bool {
+	return s.URL == other.URL &&
+		s.OnDemand == other.OnDemand &&
+		s.DisableAudio == other.DisableAudio &&
+		s.AudioTranscode == other.AudioTranscode &&
+		s.Debug == other.Debug
 }
 
 type ViewerConfig struct {
 	PacketChannel chan av.Packet // Renamed from C for clarity
+	Conn          ViewerConn
+	lastReplay    time.Time // when the GOP was last replayed to the viewer
 }
 
-// GetInstance returns singleton instance of Config
+// ViewerConn is the connection a viewer's packets are written to
+type ViewerConn interface {
+	// Relayed reports whether the connection goes through a TURN relay
+	Relayed() bool
+	// Stats returns the quality of the connection
+	Stats() webrtc.Stats
+	// Close disconnects the viewer
+	Close() error
+}
+
+// GetInstance returns singleton instance of Config. Load should be called
+// once at startup; until then built-in defaults are used.
 func GetInstance() *Config {
 	once.Do(func() {
-		instance = &Config{}
-		instance.loadConfiguration()
+		if instance == nil {
+			instance = newDefaultConfig()
+		}
 	})
 	return instance
 }
 
-// loadConfiguration loads config from file or sets default values
-func (c *Config) loadConfiguration() error {
-	data, err := ioutil.ReadFile("config/config.json")
-	if err == nil {
-		err = json.Unmarshal(data, c)
-		if err != nil {
-			return err
-		}
-
-		// Initialize viewers map for each stream
-		for id, stream := range c.Streams {
-			if stream.Viewers == nil {
-				stream.Viewers = make(map[string]ViewerConfig)
-			}
-			c.Streams[id] = stream
-		}
-	} else {
-		c.loadDefaultConfiguration()
-	}
-	return nil
-}
-
-// loadDefaultConfiguration sets default values for config
-func (c *Config) loadDefaultConfiguration() {
-	addr := flag.String("listen", ":8083", "HTTP host:port")
-	udpMin := flag.Int("udp_min", 0, "WebRTC UDP port min")
-	udpMax := flag.Int("udp_max", 0, "WebRTC UDP port max")
-	iceServer := flag.String("ice_server", "", "ICE Server")
-	flag.Parse()
-
-	c.Server.HTTPPort = *addr
-	c.Server.WebRTCPortMin = uint16(*udpMin)
-	c.Server.WebRTCPortMax = uint16(*udpMax)
-	if len(*iceServer) > 0 {
-		c.Server.ICEServers = []string{*iceServer}
-	}
-
-	c.Streams = make(map[string]StreamConfig)
-}
-
 // Server configuration getters
 func (c *Config) GetICEServers() []string {
 	c.mutex.Lock()
@@ -118,6 +274,17 @@ func (c *Config) GetICECredential() string {
 	return c.Server.ICECredential
 }
 
+// GetWebRTCPublicIPs returns the NAT 1:1 addresses to advertise in host
+// candidates, if any
+func (c *Config) GetWebRTCPublicIPs() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.Server.WebRTCPublicIP == "" {
+		return nil
+	}
+	return []string{c.Server.WebRTCPublicIP}
+}
+
 func (c *Config) GetWebRTCPortMin() uint16 {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
@@ -130,6 +297,72 @@ func (c *Config) GetWebRTCPortMax() uint16 {
 	return c.Server.WebRTCPortMax
 }
 
+func (c *Config) GetRateLimit() RateLimitConfig {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Server.RateLimit
+}
+
+func (c *Config) GetCORS() CORSConfig {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Server.CORS
+}
+
+func (c *Config) GetWorker() WorkerConfig {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Worker
+}
+
+func (c *Config) GetAuth() AuthConfig {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Server.Auth
+}
+
+func (c *Config) GetTrustedProxies() []string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Server.TrustedProxies
+}
+
+func (c *Config) GetTLS() TLSConfig {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Server.TLS
+}
+
+func (c *Config) GetSourcePolicy() SourcePolicyConfig {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Server.SourcePolicy
+}
+
+func (c *Config) GetTURN() TURNConfig {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Server.TURN
+}
+
+func (c *Config) GetCredentialKey() string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.Server.CredentialKey
+}
+
+// IsBackchannelOperator reports whether the operator may talk to cameras
+func (c *Config) IsBackchannelOperator(name string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, operator := range c.Server.BackchannelOperators {
+		if operator == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Stream management methods
 func (c *Config) StreamExists(streamID string) bool { // Renamed from Ext
 	c.mutex.Lock()
@@ -141,7 +374,57 @@ func (c *Config) StreamExists(streamID string) bool { // Renamed from Ext
 func (c *Config) AddStream(streamID string, cfg StreamConfig) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	c.Streams[streamID] = cfg
+	if existing, exists := c.Streams[streamID]; exists && existing.stop != nil {
+		close(existing.stop)
+	}
+	c.Streams[streamID] = cfg.withRuntimeState()
+}
+
+// RemoveStream deletes the stream and stops its worker
+func (c *Config) RemoveStream(streamID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if stream, exists := c.Streams[streamID]; exists {
+		if stream.stop != nil {
+			close(stream.stop)
+		}
+		delete(c.Streams, streamID)
+	}
+}
+
+// ReplaceStream swaps the source settings of a stream, stopping its current
+// worker while keeping connected viewers attached.
+func (c *Config) ReplaceStream(streamID string, cfg StreamConfig) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if existing, exists := c.Streams[streamID]; exists {
+		if existing.stop != nil {
+			close(existing.stop)
+		}
+		cfg.Viewers = existing.Viewers
+		cfg.LastViewerAt = existing.LastViewerAt
+	}
+	cfg.stop = nil
+	cfg.RunLock = false
+	c.Streams[streamID] = cfg.withRuntimeState()
+}
+
+// StreamStopped returns a channel closed once the stream is removed or
+// replaced. Workers exit when it is closed.
+func (c *Config) StreamStopped(streamID string) <-chan struct{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stream, exists := c.Streams[streamID]
+	if !exists {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	if stream.stop == nil {
+		stream = stream.withRuntimeState()
+		c.Streams[streamID] = stream
+	}
+	return stream.stop
 }
 
 func (c *Config) GetStreamCodecs(streamID string) []av.CodecData { // Renamed from CoGe
@@ -165,7 +448,7 @@ func (c *Config) GetStreamCodecs(streamID string) []av.CodecData { // Renamed fr
 }
 
 // Viewer management methods
-func (c *Config) AddViewer(streamID string) (string, chan av.Packet) { // Renamed from ClAd
+func (c *Config) AddViewer(streamID string, conn ViewerConn) (string, chan av.Packet) { // Renamed from ClAd
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
@@ -182,7 +465,8 @@ func (c *Config) AddViewer(streamID string) (string, chan av.Packet) { // Rename
 		stream.Viewers = make(map[string]ViewerConfig)
 	}
 
-	stream.Viewers[viewerID] = ViewerConfig{PacketChannel: packetChannel}
+	stream.Viewers[viewerID] = ViewerConfig{PacketChannel: packetChannel, Conn: conn}
+	stream.LastViewerAt = time.Now()
 	c.Streams[streamID] = stream
 
 	return viewerID, packetChannel
@@ -193,15 +477,45 @@ func (c *Config) RemoveViewer(streamID, viewerID string) { // Renamed from ClDe
 	defer c.mutex.Unlock()
 	if stream, exists := c.Streams[streamID]; exists {
 		delete(stream.Viewers, viewerID)
+		stream.LastViewerAt = time.Now()
+		c.Streams[streamID] = stream
+	}
+}
+
+// KickViewer disconnects a viewer of a stream. It returns false when the
+// viewer is not connected.
+func (c *Config) KickViewer(streamID, viewerID string) bool {
+	c.mutex.Lock()
+	viewer, exists := c.Streams[streamID].Viewers[viewerID]
+	c.mutex.Unlock()
+	if !exists || viewer.Conn == nil {
+		return false
+	}
+	viewer.Conn.Close()
+	return true
+}
+
+// IdleSince reports when the stream last had a viewer. ok is false while
+// viewers are connected or when the stream is unknown.
+func (c *Config) IdleSince(streamID string) (since time.Time, ok bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	stream, exists := c.Streams[streamID]
+	if !exists || len(stream.Viewers) > 0 {
+		return time.Time{}, false
 	}
+	return stream.LastViewerAt, true
 }
 
 // Stream operation methods
 func (c *Config) StartStreamIfNotRunning(streamID string) { // Renamed from RunIFNotRun
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	if stream, exists := c.Streams[streamID]; exists && stream.OnDemand {
-		go c.startStreamWorker(streamID, stream.URL, stream.OnDemand, stream.Debug)
+	if stream, exists := c.Streams[streamID]; exists && stream.OnDemand && !stream.RunLock {
+		stream = stream.withRuntimeState()
+		stream.RunLock = true
+		c.Streams[streamID] = stream
+		go c.startStreamWorker(streamID, stream.URL, stream.OnDemand, stream.Debug, stream.DisableAudio, stream.stop)
 	}
 }
 
@@ -209,6 +523,8 @@ func (c *Config) BroadcastPacket(streamID string, packet av.Packet) { // Renamed
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	if stream, exists := c.Streams[streamID]; exists {
+		stream.gop = cacheGOP(stream.gop, stream.Codecs, packet)
+		c.Streams[streamID] = stream
 		for _, viewer := range stream.Viewers {
 			select {
 			case viewer.PacketChannel <- packet:
@@ -223,10 +539,47 @@ func (c *Config) UpdateStreamCodecs(streamID string, codecs []av.CodecData) { //
 	defer c.mutex.Unlock()
 	if stream, exists := c.Streams[streamID]; exists {
 		stream.Codecs = codecs
+		stream.gop = nil
 		c.Streams[streamID] = stream
 	}
 }
 
+// SetStreamOnline records whether the worker holding stop is connected to
+// the source. Updates from a worker of a replaced stream are ignored.
+func (c *Config) SetStreamOnline(streamID string, stop <-chan struct{}, online bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if stream, exists := c.Streams[streamID]; exists {
+		if stop != nil && stream.stop != stop {
+			return
+		}
+		stream.Online = online
+		stream.gop = nil
+		c.Streams[streamID] = stream
+	}
+}
+
+// IsStreamOnline reports whether the stream's worker is connected
+func (c *Config) IsStreamOnline(streamID string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.Streams[streamID].Online
+}
+
+// LiveStreams returns the IDs of streams whose worker is connected
+func (c *Config) LiveStreams() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	var ids []string
+	for id, stream := range c.Streams {
+		if stream.Online {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
 // Error handling methods
 func (c *Config) SetLastError(err error) {
 	c.mutex.Lock()
@@ -251,9 +604,18 @@ func (c *Config) HasViewers(streamID string) bool { // Renamed from HasViewer
 }
 
 func (c *Config) UnlockStream(streamID string) { // Renamed from RunUnlock
+	c.unlockStream(streamID, nil)
+}
+
+// unlockStream clears RunLock unless the stream was replaced since the
+// worker holding stop was started.
+func (c *Config) unlockStream(streamID string, stop chan struct{}) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 	if stream, exists := c.Streams[streamID]; exists {
+		if stop != nil && stream.stop != stop {
+			return
+		}
 		if stream.OnDemand && stream.RunLock {
 			stream.RunLock = false
 			c.Streams[streamID] = stream
@@ -262,27 +624,29 @@ func (c *Config) UnlockStream(streamID string) { // Renamed from RunUnlock
 }
 
 // RTSP worker methods
-func (c *Config) startStreamWorker(streamID string, url string, onDemand bool, debug bool) {
+func (c *Config) startStreamWorker(streamID string, url string, onDemand bool, debug bool, disableAudio bool, stop chan struct{}) {
+	defer c.unlockStream(streamID, stop)
 	for {
 		log.Printf("Attempting to connect to stream: %s", streamID)
-		err := c.handleRTSPStream(streamID, url, debug)
+		err := c.handleRTSPStream(streamID, url, debug, disableAudio, stop)
 		if err != nil {
 			log.Printf("Stream error: %v", err)
 			c.SetLastError(err)
 		}
-		if onDemand {
+		if onDemand || err == errStreamExitStopped {
 			return
 		}
-		time.Sleep(time.Second)
+		time.Sleep(c.GetWorker().RetryInterval.Duration())
 	}
 }
 
-func (c *Config) handleRTSPStream(streamID string, url string, debug bool) error {
+func (c *Config) handleRTSPStream(streamID string, url string, debug bool, disableAudio bool, stop chan struct{}) error {
+	workerCfg := c.GetWorker()
 	client, err := rtspv2.Dial(rtspv2.RTSPClientOptions{
 		URL:              url,
-		DisableAudio:     true,
-		DialTimeout:      3 * time.Second,
-		ReadWriteTimeout: 3 * time.Second,
+		DisableAudio:     disableAudio,
+		DialTimeout:      workerCfg.DialTimeout.Duration(),
+		ReadWriteTimeout: workerCfg.ReadWriteTimeout.Duration(),
 		Debug:            debug,
 	})
 	if err != nil {
@@ -290,13 +654,39 @@ func (c *Config) handleRTSPStream(streamID string, url string, debug bool) error
 	}
 	defer client.Close()
 
-	if client.CodecData != nil {
-		c.UpdateStreamCodecs(streamID, client.CodecData)
+	c.SetStreamOnline(streamID, stop, true)
+	defer c.SetStreamOnline(streamID, stop, false)
+
+	transcoder, codecs := c.StartTranscoder(streamID, stop, client.CodecData)
+	defer transcoder.Close()
+	if codecs != nil {
+		c.UpdateStreamCodecs(streamID, codecs)
 	}
 
+	viewerTest := time.NewTicker(workerCfg.ViewerCheckInterval.Duration())
+	defer viewerTest.Stop()
+
 	for {
-		packet := <-client.OutgoingPacketQueue
-		c.BroadcastPacket(streamID, *packet)
+		select {
+		case <-stop:
+			return errStreamExitStopped
+		case <-viewerTest.C:
+			if !c.HasViewers(streamID) {
+				return errStreamExitNoViewer
+			}
+		case signal := <-client.Signals:
+			if c.HandleSourceSignal(streamID, signal, client.CodecData, transcoder) {
+				return errStreamExitRtspDisconnect
+			}
+		case packet := <-client.OutgoingPacketQueue:
+			packets, err := transcoder.Transcode(*packet)
+			if err != nil && debug {
+				log.Printf("Stream %s: audio transcode: %v", streamID, err)
+			}
+			for _, out := range packets {
+				c.BroadcastPacket(streamID, out)
+			}
+		}
 	}
 }
 
@@ -309,6 +699,5 @@ func (c *Config) SyncStreamConfig(streamID string, url string, onDemand bool) {
 		URL:      url,
 		Status:   true,
 		OnDemand: onDemand,
-		Viewers:  make(map[string]ViewerConfig),
-	}
+	}.withRuntimeState()
 }
@@ -0,0 +1,54 @@
+package config
+
+import "time"
+
+// newDefaultConfig returns the built-in configuration every source is
+// layered on top of.
+func newDefaultConfig() *Config {
+	return &Config{
+		Server: ServerConfig{
+			HTTPPort:   ":8083",
+			ICEServers: []string{"stun:stun.l.google.com:19302"},
+			SourcePolicy: SourcePolicyConfig{
+				AllowedSchemes:       []string{"rtsp", "rtsps"},
+				EphemeralIdleTimeout: Duration(10 * time.Minute),
+			},
+			CORS: CORSConfig{
+				AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+				AllowedHeaders: []string{"Origin", "X-Requested-With", "Content-Type", "Accept", "Authorization", "x-access-token"},
+				ExposedHeaders: []string{"Content-Length", "Cache-Control", "Content-Language", "Content-Type", "Retry-After"},
+				MaxAge:         Duration(10 * time.Minute),
+			},
+			TURN: TURNConfig{
+				Listen:        ":3478",
+				Realm:         "stream_camera",
+				CredentialTTL: Duration(time.Hour),
+				DeniedPeerCIDRs: []string{
+					"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8",
+					"169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16", "224.0.0.0/4",
+					"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+				},
+			},
+		},
+		Database: DatabaseConfig{
+			Driver:      "postgres",
+			Path:        "stream_camera.db",
+			Host:        "localhost",
+			Port:        5432,
+			User:        "postgres",
+			Name:        "keran_kitera",
+			SSLMode:     "disable",
+			TimeZone:    "Asia/Jakarta",
+			AutoMigrate: true,
+		},
+		Worker: WorkerConfig{
+			DialTimeout:          Duration(3 * time.Second),
+			ReadWriteTimeout:     Duration(3 * time.Second),
+			KeyframeTimeout:      Duration(20 * time.Second),
+			ViewerCheckInterval:  Duration(20 * time.Second),
+			RetryInterval:        Duration(time.Second),
+			ViewerNoVideoTimeout: Duration(10 * time.Second),
+		},
+		Streams: make(map[string]StreamConfig),
+	}
+}
@@ -0,0 +1,290 @@
+package config
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultConfigFiles are tried in order when no config file is given
+var defaultConfigFiles = []string{"config.json", "config.yaml", "config.yml"}
+
+// option is a setting that can be overridden from the environment and the
+// command line. Precedence is defaults < config file < environment < flags.
+type option struct {
+	flag  string
+	env   string
+	usage string
+	apply func(c *Config, value string) error
+}
+
+var options = []option{
+	{"listen", "HTTP_PORT", "HTTP host:port", setString(func(c *Config) *string { return &c.Server.HTTPPort })},
+	{"ice_server", "ICE_SERVERS", "comma separated ICE server URLs", setList(func(c *Config) *[]string { return &c.Server.ICEServers })},
+	{"ice_username", "ICE_USERNAME", "ICE server username", setString(func(c *Config) *string { return &c.Server.ICEUsername })},
+	{"ice_credential", "ICE_CREDENTIAL", "ICE server credential", setString(func(c *Config) *string { return &c.Server.ICECredential })},
+	{"udp_min", "WEBRTC_PORT_MIN", "WebRTC UDP port min", setPort(func(c *Config) *uint16 { return &c.Server.WebRTCPortMin })},
+	{"udp_max", "WEBRTC_PORT_MAX", "WebRTC UDP port max", setPort(func(c *Config) *uint16 { return &c.Server.WebRTCPortMax })},
+	{"udp_port", "WEBRTC_UDP_PORT", "single UDP port shared by all WebRTC sessions", setPort(func(c *Config) *uint16 { return &c.Server.WebRTCUDPPort })},
+	{"tcp_port", "WEBRTC_TCP_PORT", "ICE-TCP port for WebRTC sessions", setPort(func(c *Config) *uint16 { return &c.Server.WebRTCTCPPort })},
+	{"public_ip", "WEBRTC_PUBLIC_IP", "NAT 1:1 public IP advertised in WebRTC candidates", setString(func(c *Config) *string { return &c.Server.WebRTCPublicIP })},
+	{"tls_cert", "TLS_CERT_FILE", "TLS certificate file", setString(func(c *Config) *string { return &c.Server.TLS.CertFile })},
+	{"tls_key", "TLS_KEY_FILE", "TLS private key file", setString(func(c *Config) *string { return &c.Server.TLS.KeyFile })},
+	{"turn", "TURN_ENABLED", "run the embedded TURN server", setBool(func(c *Config) *bool { return &c.Server.TURN.Enabled })},
+	{"turn_listen", "TURN_LISTEN", "embedded TURN server UDP/TCP host:port", setString(func(c *Config) *string { return &c.Server.TURN.Listen })},
+	{"turn_public_ip", "TURN_PUBLIC_IP", "public IP of the embedded TURN server", setString(func(c *Config) *string { return &c.Server.TURN.PublicIP })},
+	{"turn_secret", "TURN_SECRET", "secret signing embedded TURN credentials", setString(func(c *Config) *string { return &c.Server.TURN.Secret })},
+	{"backchannel_operator", "BACKCHANNEL_OPERATORS", "comma separated operators allowed to talk to cameras", setList(func(c *Config) *[]string { return &c.Server.BackchannelOperators })},
+	{"auth_token_secret", "AUTH_TOKEN_SECRET", "secret signing operator tokens", setString(func(c *Config) *string { return &c.Server.Auth.TokenSecret })},
+	{"trusted_proxy", "TRUSTED_PROXIES", "comma separated reverse proxy IPs or CIDRs trusted for X-Forwarded-For", setList(func(c *Config) *[]string { return &c.Server.TrustedProxies })},
+	{"credential_key", "CREDENTIAL_KEY", "passphrase encrypting credentials in stream exports", setString(func(c *Config) *string { return &c.Server.CredentialKey })},
+	{"db_driver", "DB_DRIVER", "database driver: postgres, sqlite or memory", setString(func(c *Config) *string { return &c.Database.Driver })},
+	{"db_path", "DB_PATH", "sqlite database file", setString(func(c *Config) *string { return &c.Database.Path })},
+	{"db_host", "DB_HOST", "database host", setString(func(c *Config) *string { return &c.Database.Host })},
+	{"db_port", "DB_PORT", "database port", setInt(func(c *Config) *int { return &c.Database.Port })},
+	{"db_user", "DB_USER", "database user", setString(func(c *Config) *string { return &c.Database.User })},
+	{"db_password", "DB_PASSWORD", "database password", setString(func(c *Config) *string { return &c.Database.Password })},
+	{"db_name", "DB_NAME", "database name", setString(func(c *Config) *string { return &c.Database.Name })},
+	{"db_sslmode", "DB_SSLMODE", "database sslmode", setString(func(c *Config) *string { return &c.Database.SSLMode })},
+	{"db_timezone", "DB_TIMEZONE", "database time zone", setString(func(c *Config) *string { return &c.Database.TimeZone })},
+	{"import_config_streams", "IMPORT_CONFIG_STREAMS", "import config file streams into the database at startup", setBool(func(c *Config) *bool { return &c.Database.ImportConfigStreams })},
+	{"dial_timeout", "WORKER_DIAL_TIMEOUT", "RTSP dial timeout", setDuration(func(c *Config) *Duration { return &c.Worker.DialTimeout })},
+	{"read_write_timeout", "WORKER_READ_WRITE_TIMEOUT", "RTSP read/write timeout", setDuration(func(c *Config) *Duration { return &c.Worker.ReadWriteTimeout })},
+	{"keyframe_timeout", "WORKER_KEYFRAME_TIMEOUT", "restart a source after this long without a keyframe", setDuration(func(c *Config) *Duration { return &c.Worker.KeyframeTimeout })},
+}
+
+// Load builds the configuration from defaults, the config file, the
+// environment (including a .env file) and the command line flags in args,
+// validates it and installs it as the singleton instance.
+func Load(args []string) (*Config, error) {
+	c, err := load(args)
+	if err != nil {
+		return nil, err
+	}
+	instance = c
+	once.Do(func() {})
+	return c, nil
+}
+
+func load(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("stream_camera", flag.ContinueOnError)
+	configFile := fs.String("config", "", "path to a JSON or YAML config file")
+	envFile := fs.String("env_file", ".env", "path to a dotenv file")
+	flagValues := make(map[string]*string, len(options))
+	for _, opt := range options {
+		flagValues[opt.flag] = fs.String(opt.flag, "", fmt.Sprintf("%s (env %s)", opt.usage, opt.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	c := newDefaultConfig()
+
+	c.args = args
+	c.envPath = *envFile
+	// The env file is read on every load and layered under the process
+	// environment, so edits to it apply on reload
+	dotEnv, err := loadDotEnv(*envFile)
+	if err != nil {
+		return nil, err
+	}
+	lookupEnv := func(key string) (string, bool) {
+		if value, ok := os.LookupEnv(key); ok {
+			return value, true
+		}
+		value, ok := dotEnv[key]
+		return value, ok
+	}
+
+	path := *configFile
+	if path == "" {
+		path, _ = lookupEnv("CONFIG_FILE")
+	}
+	if err := c.loadFile(path); err != nil {
+		return nil, err
+	}
+
+	for _, opt := range options {
+		if value, ok := lookupEnv(opt.env); ok {
+			if err := opt.apply(c, value); err != nil {
+				return nil, fmt.Errorf("environment %s: %w", opt.env, err)
+			}
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		if flagErr != nil {
+			return
+		}
+		for _, opt := range options {
+			if opt.flag == f.Name {
+				if err := opt.apply(c, *flagValues[f.Name]); err != nil {
+					flagErr = fmt.Errorf("flag -%s: %w", f.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	c.fileStreams = make(map[string]StreamConfig, len(c.Streams))
+	for id, stream := range c.Streams {
+		c.fileStreams[id] = stream
+		c.Streams[id] = stream.withRuntimeState()
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadFile merges the config file at path into c. An empty path falls back
+// to the default file names, which may be absent.
+func (c *Config) loadFile(path string) error {
+	if path == "" {
+		for _, candidate := range defaultConfigFiles {
+			if _, err := os.Stat(candidate); err == nil {
+				path = candidate
+				break
+			}
+		}
+		if path == "" {
+			return nil
+		}
+	}
+	c.path = path
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		// YAML is converted to JSON so both formats share the json tags
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+		if data, err = json.Marshal(raw); err != nil {
+			return fmt.Errorf("parse %s: %w", path, err)
+		}
+	case ".json", "":
+	default:
+		return fmt.Errorf("config file %s: unsupported format %q", path, filepath.Ext(path))
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(data)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(c); err != nil {
+		return fmt.Errorf("parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadDotEnv returns the variables of a dotenv file without touching the
+// process environment. A missing file is not an error.
+func loadDotEnv(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read env file: %w", err)
+	}
+	defer file.Close()
+
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimPrefix(line, "export "), "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, lineNo)
+		}
+		vars[strings.TrimSpace(key)] = strings.Trim(strings.TrimSpace(value), `"'`)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read env file: %w", err)
+	}
+	return vars, nil
+}
+
+func setString(field func(*Config) *string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func setList(field func(*Config) *[]string) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		*field(c) = list
+		return nil
+	}
+}
+
+func setBool(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", value)
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func setInt(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", value)
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func setPort(field func(*Config) *uint16) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		n, err := strconv.ParseUint(value, 10, 16)
+		if err != nil {
+			return fmt.Errorf("%q is not a port number", value)
+		}
+		*field(c) = uint16(n)
+		return nil
+	}
+}
+
+func setDuration(field func(*Config) *Duration) func(*Config, string) error {
+	return func(c *Config, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", value)
+		}
+		*field(c) = Duration(d)
+		return nil
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// ReloadResult describes what a configuration reload changed
+type ReloadResult struct {
+	Added           []string `json:"added,omitempty"`
+	Removed         []string `json:"removed,omitempty"`
+	Changed         []string `json:"changed,omitempty"`
+	ServerChanged   bool     `json:"server_changed"`
+	RestartRequired []string `json:"restart_required,omitempty"`
+}
+
+// FilePath returns the config file in use, or "" when none was found
+func (c *Config) FilePath() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.path
+}
+
+// EnvFilePath returns the dotenv file the configuration reads, which may
+// not exist
+func (c *Config) EnvFilePath() string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.envPath
+}
+
+// FileStreams returns the IDs of the streams defined in the config file
+func (c *Config) FileStreams() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	ids := make([]string, 0, len(c.fileStreams))
+	for id := range c.fileStreams {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Reload re-reads every configuration source with the original command
+// line. Invalid configuration is rejected and leaves the running config
+// untouched. Server and worker settings apply to new sessions, except those
+// read at startup, which keep their running values and are reported in
+// RestartRequired. Config file streams are added, replaced or removed,
+// stopping workers of removed or changed streams. Starting workers is left
+// to the caller.
+func (c *Config) Reload() (*ReloadResult, error) {
+	c.mutex.RLock()
+	args := c.args
+	c.mutex.RUnlock()
+
+	next, err := load(args)
+	if err != nil {
+		return nil, err
+	}
+	if previous := c.FilePath(); previous != "" && next.path == "" {
+		return nil, fmt.Errorf("config file %s is missing", previous)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Settings read once at startup keep their running values until a
+	// restart, so the configuration describes what is actually served
+	result := &ReloadResult{}
+	server := next.Server
+	restartRequired := func(name string, changed bool) {
+		if changed {
+			result.RestartRequired = append(result.RestartRequired, name)
+		}
+	}
+	restartRequired("server.http_port", keepRunning(&server.HTTPPort, c.Server.HTTPPort))
+	restartRequired("server.tls", keepRunning(&server.TLS, c.Server.TLS))
+	restartRequired("server.cors", keepRunning(&server.CORS, c.Server.CORS))
+	restartRequired("server.rate_limit", keepRunning(&server.RateLimit, c.Server.RateLimit))
+	restartRequired("server.trusted_proxies", keepRunning(&server.TrustedProxies, c.Server.TrustedProxies))
+	restartRequired("server.webrtc_udp_port", keepRunning(&server.WebRTCUDPPort, c.Server.WebRTCUDPPort))
+	restartRequired("server.webrtc_tcp_port", keepRunning(&server.WebRTCTCPPort, c.Server.WebRTCTCPPort))
+	restartRequired("server.turn", keepRunning(&server.TURN, c.Server.TURN))
+	restartRequired("database", c.Database != next.Database)
+	result.ServerChanged = !reflect.DeepEqual(c.Server, server) || c.Worker != next.Worker
+
+	c.Server = server
+	c.Worker = next.Worker
+	c.path = next.path
+	c.envPath = next.envPath
+
+	for id, old := range c.fileStreams {
+		updated, exists := next.fileStreams[id]
+		switch {
+		case !exists:
+			if stream, ok := c.Streams[id]; ok {
+				if stream.stop != nil {
+					close(stream.stop)
+				}
+				delete(c.Streams, id)
+			}
+			result.Removed = append(result.Removed, id)
+		case !old.sameSource(updated):
+			stream := c.Streams[id]
+			if stream.stop != nil {
+				close(stream.stop)
+			}
+			updated.Viewers = stream.Viewers
+			updated.LastViewerAt = stream.LastViewerAt
+			c.Streams[id] = updated.withRuntimeState()
+			result.Changed = append(result.Changed, id)
+		case old.Backchannel != updated.Backchannel:
+			// Applies to the next talk session; the worker keeps running
+			if stream, ok := c.Streams[id]; ok {
+				stream.Backchannel = updated.Backchannel
+				c.Streams[id] = stream
+			}
+		}
+	}
+	for id, stream := range next.fileStreams {
+		if _, exists := c.fileStreams[id]; !exists {
+			c.Streams[id] = stream.withRuntimeState()
+			result.Added = append(result.Added, id)
+		}
+	}
+	c.fileStreams = next.fileStreams
+
+	sort.Strings(result.Added)
+	sort.Strings(result.Removed)
+	sort.Strings(result.Changed)
+	return result, nil
+}
+
+// keepRunning resets a reloaded setting to its running value and reports
+// whether the reload changed it
+func keepRunning[T any](next *T, running T) bool {
+	changed := !reflect.DeepEqual(*next, running)
+	*next = running
+	return changed
+}
+
+// GetStream returns a copy of the stream settings
+func (c *Config) GetStream(streamID string) (StreamConfig, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	stream, exists := c.Streams[streamID]
+	return stream, exists
+}
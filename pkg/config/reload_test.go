@@ -0,0 +1,49 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReloadKeepsRestartOnlySettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"server": {"http_port": ":8083", "webrtc_udp_port": 8189, "ice_servers": ["stun:a.example.com:3478"], "cors": {"allowed_origins": ["https://a.example.com"]}}}`)
+	c, err := Load([]string{"-config", path, "-env_file", "none"})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	write(`{"server": {"http_port": ":9000", "webrtc_udp_port": 9189, "ice_servers": ["stun:b.example.com:3478"], "cors": {"allowed_origins": ["https://b.example.com"]}}}`)
+	result, err := c.Reload()
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	wantRestart := []string{"server.http_port", "server.cors", "server.webrtc_udp_port"}
+	if !reflect.DeepEqual(result.RestartRequired, wantRestart) {
+		t.Errorf("restart required = %v, want %v", result.RestartRequired, wantRestart)
+	}
+	if !result.ServerChanged {
+		t.Error("server_changed = false, want true for the new ICE servers")
+	}
+	if got := c.Server.HTTPPort; got != ":8083" {
+		t.Errorf("http_port = %q, want the running :8083", got)
+	}
+	if got := c.Server.WebRTCUDPPort; got != 8189 {
+		t.Errorf("webrtc_udp_port = %d, want the running 8189", got)
+	}
+	if got := c.GetCORS().AllowedOrigins; !reflect.DeepEqual(got, []string{"https://a.example.com"}) {
+		t.Errorf("cors origins = %v, want the running origins", got)
+	}
+	if got := c.GetICEServers(); !reflect.DeepEqual(got, []string{"stun:b.example.com:3478"}) {
+		t.Errorf("ice_servers = %v, want the reloaded servers", got)
+	}
+}
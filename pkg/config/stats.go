@@ -0,0 +1,186 @@
+package config
+
+import (
+	"log"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/transcode"
+	"github.com/DaffaJatmiko/stream_camera/pkg/webrtc"
+	"github.com/deepch/vdk/av"
+	"github.com/deepch/vdk/format/rtspv2"
+)
+
+// StreamStats is the runtime state of a stream's worker
+type StreamStats struct {
+	Online         bool
+	Viewers        int
+	RelayedViewers int // viewers connected through a TURN relay
+	Codecs         []av.CodecData
+	Transcode      *transcode.Stats
+	TranscodeError string
+	// Connections holds the connection quality of each viewer by viewer ID
+	Connections map[string]webrtc.Stats
+	// Keyframe requests from viewers; Coalesced counts those that arrived
+	// within keyframeRequestWindow of the previous one and Replays the
+	// cached GOPs sent in answer
+	KeyframeRequests          uint64
+	KeyframeRequestsCoalesced uint64
+	KeyframeReplays           uint64
+	LastKeyframeRequest       time.Time
+}
+
+// keyframeRequestWindow merges the keyframe requests of all viewers of a
+// stream in the stats, and the requests of one viewer into one replay
+const keyframeRequestWindow = time.Second
+
+// maxGOPPackets bounds the GOP cache of a stream. Longer GOPs are not
+// cached until the next keyframe.
+const maxGOPPackets = 600
+
+type keyframeRequests struct {
+	received  uint64
+	coalesced uint64
+	replays   uint64
+	last      time.Time
+}
+
+// RequestKeyframe records a keyframe request from a viewer of the stream.
+// It returns false when the request is coalesced with an earlier one. The
+// request is not forwarded to the source; viewers are sent the cached GOP
+// instead, see ReplayGOP.
+func (c *Config) RequestKeyframe(streamID string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stream, exists := c.Streams[streamID]
+	if !exists {
+		return false
+	}
+
+	now := time.Now()
+	stream.keyframes.received++
+	coalesced := now.Sub(stream.keyframes.last) < keyframeRequestWindow
+	if coalesced {
+		stream.keyframes.coalesced++
+	} else {
+		stream.keyframes.last = now
+	}
+	c.Streams[streamID] = stream
+	return !coalesced
+}
+
+// ReplayGOP returns a copy of the video packets since the stream's last
+// keyframe for a viewer that asked for a keyframe, or nil when none are
+// cached or the viewer got a replay within keyframeRequestWindow. The
+// viewer's queue is left alone: its audio still has to be sent, and the
+// muxer drops the queued video the replay already includes.
+func (c *Config) ReplayGOP(streamID, viewerID string) []av.Packet {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stream, exists := c.Streams[streamID]
+	if !exists || len(stream.gop) == 0 {
+		return nil
+	}
+	viewer, exists := stream.Viewers[viewerID]
+	now := time.Now()
+	if !exists || now.Sub(viewer.lastReplay) < keyframeRequestWindow {
+		return nil
+	}
+
+	viewer.lastReplay = now
+	stream.Viewers[viewerID] = viewer
+	stream.keyframes.replays++
+	c.Streams[streamID] = stream
+	return append([]av.Packet(nil), stream.gop...)
+}
+
+// cacheGOP adds packet to the GOP cache of a stream sending codecs. A
+// keyframe starts a new GOP; audio is not cached since it does not depend on
+// earlier frames.
+func cacheGOP(gop []av.Packet, codecs []av.CodecData, packet av.Packet) []av.Packet {
+	switch {
+	case packet.Idx < 0 || int(packet.Idx) >= len(codecs) || !codecs[packet.Idx].Type().IsVideo():
+		return gop
+	case packet.IsKeyFrame:
+		return append(gop[:0], packet)
+	case len(gop) == 0 || len(gop) >= maxGOPPackets:
+		return nil
+	}
+	return append(gop, packet)
+}
+
+// StartTranscoder creates the audio transcoder of the worker holding stop
+// and returns it with the codecs viewers receive. When the stream has no
+// transcode target, its audio is playable as is or the transcoder cannot be
+// created, it returns a nil transcoder and the source codecs.
+func (c *Config) StartTranscoder(streamID string, stop <-chan struct{}, codecs []av.CodecData) (*transcode.Transcoder, []av.CodecData) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	stream, exists := c.Streams[streamID]
+	if !exists || (stop != nil && stream.stop != stop) {
+		return nil, codecs
+	}
+
+	transcoder, err := transcode.New(codecs, stream.AudioTranscode)
+	stream.Transcoder = transcoder
+	stream.TranscodeError = ""
+	if err != nil {
+		log.Printf("Stream %s: audio is not transcoded: %v", streamID, err)
+		stream.TranscodeError = err.Error()
+	}
+	c.Streams[streamID] = stream
+	return transcoder, transcoder.Apply(codecs)
+}
+
+// HandleSourceSignal applies a signal of the RTSP client feeding the stream
+// and reports whether the source stopped sending. Codec changes reach the
+// viewers through the stream's transcoder.
+func (c *Config) HandleSourceSignal(streamID string, signal int, codecs []av.CodecData, transcoder *transcode.Transcoder) bool {
+	switch signal {
+	case rtspv2.SignalCodecUpdate:
+		c.UpdateStreamCodecs(streamID, transcoder.Apply(codecs))
+	case rtspv2.SignalStreamRTPStop:
+		return true
+	}
+	return false
+}
+
+// GetStreamStats returns the runtime state of a loaded stream
+func (c *Config) GetStreamStats(streamID string) (StreamStats, bool) {
+	c.mutex.RLock()
+	stream, exists := c.Streams[streamID]
+	stats := StreamStats{
+		Online:         stream.Online,
+		Viewers:        len(stream.Viewers),
+		Codecs:         stream.Codecs,
+		TranscodeError: stream.TranscodeError,
+
+		KeyframeRequests:          stream.keyframes.received,
+		KeyframeRequestsCoalesced: stream.keyframes.coalesced,
+		KeyframeReplays:           stream.keyframes.replays,
+		LastKeyframeRequest:       stream.keyframes.last,
+	}
+	conns := make(map[string]ViewerConn, len(stream.Viewers))
+	for viewerID, viewer := range stream.Viewers {
+		if viewer.Conn != nil {
+			conns[viewerID] = viewer.Conn
+		}
+	}
+	c.mutex.RUnlock()
+	if !exists {
+		return StreamStats{}, false
+	}
+
+	stats.Connections = make(map[string]webrtc.Stats, len(conns))
+	for viewerID, conn := range conns {
+		if conn.Relayed() {
+			stats.RelayedViewers++
+		}
+		stats.Connections[viewerID] = conn.Stats()
+	}
+
+	if stream.Transcoder != nil {
+		transcodeStats := stream.Transcoder.Stats()
+		stats.Transcode = &transcodeStats
+	}
+	return stats, true
+}
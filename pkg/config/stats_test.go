@@ -0,0 +1,43 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deepch/vdk/av"
+)
+
+type testCodec av.CodecType
+
+func (c testCodec) Type() av.CodecType { return av.CodecType(c) }
+
+func TestReplayGOPKeepsViewerQueue(t *testing.T) {
+	c := newDefaultConfig()
+	c.Streams["cam"] = StreamConfig{}
+	c.UpdateStreamCodecs("cam", []av.CodecData{testCodec(av.H264), testCodec(av.PCM_ALAW)})
+	viewerID, queue := c.AddViewer("cam", nil)
+
+	packets := []av.Packet{
+		{Idx: 0, IsKeyFrame: true, Time: 0, Data: []byte{1}},
+		{Idx: 1, Time: 10 * time.Millisecond, Data: []byte{2}},
+		{Idx: 0, Time: 40 * time.Millisecond, Data: []byte{3}},
+		{Idx: 1, Time: 50 * time.Millisecond, Data: []byte{4}},
+	}
+	for _, packet := range packets {
+		c.BroadcastPacket("cam", packet)
+	}
+
+	replay := c.ReplayGOP("cam", viewerID)
+	if len(replay) != 2 || replay[0].Time != 0 || replay[1].Time != 40*time.Millisecond {
+		t.Fatalf("replay = %+v, want the two video packets", replay)
+	}
+	if len(queue) != len(packets) {
+		t.Errorf("viewer queue holds %d packets after the replay, want %d", len(queue), len(packets))
+	}
+	if again := c.ReplayGOP("cam", viewerID); again != nil {
+		t.Errorf("second replay within the window = %d packets, want none", len(again))
+	}
+	if replays := c.Streams["cam"].keyframes.replays; replays != 1 {
+		t.Errorf("replays = %d, want 1", replays)
+	}
+}
@@ -0,0 +1,223 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/transcode"
+)
+
+// ValidationError lists every invalid setting found in a configuration
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return "invalid configuration:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// Validate checks the configuration and reports all problems at once
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	v.address("server.http_port", c.Server.HTTPPort)
+	for i, server := range c.Server.ICEServers {
+		if !hasAnyPrefix(server, "stun:", "stuns:", "turn:", "turns:") {
+			v.addf("server.ice_servers[%d]: %q must start with stun:, stuns:, turn: or turns:", i, server)
+		}
+	}
+	if (c.Server.WebRTCPortMin == 0) != (c.Server.WebRTCPortMax == 0) {
+		v.addf("server.webrtc_port_min and server.webrtc_port_max must be set together")
+	} else if c.Server.WebRTCPortMin > c.Server.WebRTCPortMax {
+		v.addf("server.webrtc_port_min (%d) must not exceed server.webrtc_port_max (%d)", c.Server.WebRTCPortMin, c.Server.WebRTCPortMax)
+	}
+	if ip := c.Server.WebRTCPublicIP; ip != "" && net.ParseIP(ip) == nil {
+		v.addf("server.webrtc_public_ip: %q is not an IP address", ip)
+	}
+	if key := c.Server.CredentialKey; key != "" && len(key) < 16 {
+		v.addf("server.credential_key must be at least 16 characters")
+	}
+	if secret := c.Server.Auth.TokenSecret; secret != "" && len(secret) < 32 {
+		v.addf("server.auth.token_secret must be at least 32 characters")
+	}
+
+	for i, proxy := range c.Server.TrustedProxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			v.addf("server.trusted_proxies[%d]: %q is not an IP address or CIDR", i, proxy)
+		}
+	}
+
+	rl := c.Server.RateLimit
+	if rl.Signaling.PerIP < 0 || rl.Signaling.PerPrincipal < 0 || rl.Signaling.Burst < 0 {
+		v.addf("server.rate_limit.signaling: limits must not be negative")
+	}
+	if rl.API.PerIP < 0 || rl.API.PerPrincipal < 0 || rl.API.Burst < 0 {
+		v.addf("server.rate_limit.api: limits must not be negative")
+	}
+	if rl.MaxPeerConnectionsPerClient < 0 {
+		v.addf("server.rate_limit.max_peer_connections_per_client must not be negative")
+	}
+
+	sp := c.Server.SourcePolicy
+	if len(sp.AllowedSchemes) == 0 && !sp.DisableURLPlayback {
+		v.addf("server.source_policy.allowed_schemes must not be empty")
+	}
+	for i, cidr := range sp.AllowedCIDRs {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			v.addf("server.source_policy.allowed_cidrs[%d]: %q is not a CIDR", i, cidr)
+		}
+	}
+	for i, port := range sp.AllowedPorts {
+		if port < 1 || port > 65535 {
+			v.addf("server.source_policy.allowed_ports[%d]: %d is out of range", i, port)
+		}
+	}
+	v.positive("server.source_policy.ephemeral_idle_timeout", sp.EphemeralIdleTimeout)
+
+	cors := c.Server.CORS
+	for i, origin := range cors.AllowedOrigins {
+		if origin == "*" {
+			if cors.AllowCredentials {
+				v.addf("server.cors.allowed_origins[%d]: \"*\" cannot be combined with allow_credentials", i)
+			}
+			continue
+		}
+		if u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1)); err != nil || u.Scheme == "" || u.Host == "" {
+			v.addf("server.cors.allowed_origins[%d]: %q is not an origin like https://app.example.com", i, origin)
+		}
+	}
+
+	tls := c.Server.TLS
+	if (tls.CertFile == "") != (tls.KeyFile == "") {
+		v.addf("server.tls.cert_file and server.tls.key_file must be set together")
+	}
+	if tls.MinVersion != "" && tls.MinVersion != "1.2" && tls.MinVersion != "1.3" {
+		v.addf("server.tls.min_version: %q must be \"1.2\" or \"1.3\"", tls.MinVersion)
+	}
+	switch tls.ClientAuth {
+	case "", "request", "require", "verify":
+	default:
+		v.addf("server.tls.client_auth: %q must be request, require or verify", tls.ClientAuth)
+	}
+	if tls.ClientAuth != "" && tls.ClientCAFile == "" {
+		v.addf("server.tls.client_auth requires server.tls.client_ca_file")
+	}
+	if tls.RedirectPort != "" {
+		v.address("server.tls.redirect_port", tls.RedirectPort)
+	}
+
+	turn := c.Server.TURN
+	if turn.Enabled {
+		v.address("server.turn.listen", turn.Listen)
+		if turn.TLSListen != "" {
+			v.address("server.turn.tls_listen", turn.TLSListen)
+			if !tls.Enabled() {
+				v.addf("server.turn.tls_listen requires server.tls.cert_file and server.tls.key_file")
+			}
+		}
+		if net.ParseIP(turn.PublicIP) == nil {
+			v.addf("server.turn.public_ip: %q is not an IP address", turn.PublicIP)
+		}
+		if len(turn.Secret) < 16 {
+			v.addf("server.turn.secret must be at least 16 characters")
+		}
+		if turn.Realm == "" {
+			v.addf("server.turn.realm must be set")
+		}
+		for i, cidr := range turn.DeniedPeerCIDRs {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				v.addf("server.turn.denied_peer_cidrs[%d]: %q is not a CIDR", i, cidr)
+			}
+		}
+		v.positive("server.turn.credential_ttl", turn.CredentialTTL)
+		if (turn.RelayPortMin == 0) != (turn.RelayPortMax == 0) {
+			v.addf("server.turn.relay_port_min and server.turn.relay_port_max must be set together")
+		} else if turn.RelayPortMin > turn.RelayPortMax {
+			v.addf("server.turn.relay_port_min (%d) must not exceed server.turn.relay_port_max (%d)", turn.RelayPortMin, turn.RelayPortMax)
+		}
+	}
+
+	db := c.Database
+	switch db.Driver {
+	case "postgres":
+		if db.Host == "" {
+			v.addf("database.host must be set")
+		}
+		if db.Port < 1 || db.Port > 65535 {
+			v.addf("database.port: %d is out of range", db.Port)
+		}
+		if db.User == "" {
+			v.addf("database.user must be set")
+		}
+		if db.Name == "" {
+			v.addf("database.name must be set")
+		}
+	case "sqlite":
+		if db.Path == "" {
+			v.addf("database.path must be set for the sqlite driver")
+		}
+	case "memory":
+	default:
+		v.addf("database.driver: %q must be postgres, sqlite or memory", db.Driver)
+	}
+
+	v.positive("worker.dial_timeout", c.Worker.DialTimeout)
+	v.positive("worker.read_write_timeout", c.Worker.ReadWriteTimeout)
+	v.positive("worker.keyframe_timeout", c.Worker.KeyframeTimeout)
+	v.positive("worker.viewer_check_interval", c.Worker.ViewerCheckInterval)
+	v.positive("worker.retry_interval", c.Worker.RetryInterval)
+	v.positive("worker.viewer_no_video_timeout", c.Worker.ViewerNoVideoTimeout)
+
+	for id, stream := range c.Streams {
+		if stream.URL == "" {
+			v.addf("streams.%s.url must be set", id)
+		} else if u, err := url.Parse(stream.URL); err != nil || u.Host == "" {
+			v.addf("streams.%s.url: %q is not a valid URL", id, stream.URL)
+		}
+		if !transcode.ValidTarget(stream.AudioTranscode) {
+			v.addf("streams.%s.audio_transcode: %q must be opus, pcma or pcmu", id, stream.AudioTranscode)
+		} else if err := transcode.CheckTarget(stream.AudioTranscode); err != nil {
+			v.addf("streams.%s.audio_transcode: %v; build with -tags 'faad opus'", id, err)
+		}
+	}
+
+	return v.err()
+}
+
+type validator struct {
+	problems []string
+}
+
+func (v *validator) addf(format string, args ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, args...))
+}
+
+func (v *validator) address(field string, addr string) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		v.addf("%s: %q is not a host:port address", field, addr)
+	}
+}
+
+func (v *validator) positive(field string, d Duration) {
+	if d <= 0 {
+		v.addf("%s must be a positive duration", field)
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+func hasAnyPrefix(s string, prefixes ...string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
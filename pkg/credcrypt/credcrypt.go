@@ -0,0 +1,141 @@
+// Package credcrypt encrypts stream credentials for export with AES-256-GCM
+// under a key derived from a passphrase with scrypt.
+//
+// A sealed value is "enc:v1:" followed by base64url(salt | nonce | ciphertext).
+// A Sealer uses one random salt for all values it seals, so the key is only
+// derived once per export; an Opener caches derived keys by salt.
+package credcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	prefix  = "enc:v1:"
+	saltLen = 16
+)
+
+var (
+	// ErrNoPassphrase is returned when sealing or opening without a passphrase
+	ErrNoPassphrase = errors.New("credential passphrase is not set")
+	// ErrMalformed is returned for a value that is not a sealed credential
+	ErrMalformed = errors.New("malformed encrypted credential")
+	// ErrDecrypt is returned when the passphrase is wrong or the value was tampered with
+	ErrDecrypt = errors.New("cannot decrypt credential: wrong passphrase or corrupted value")
+)
+
+// IsSealed reports whether s looks like a sealed value
+func IsSealed(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// Sealer encrypts values under a single derived key
+type Sealer struct {
+	salt []byte
+	aead cipher.AEAD
+}
+
+// NewSealer derives a key from passphrase with a fresh random salt
+func NewSealer(passphrase string) (*Sealer, error) {
+	if passphrase == "" {
+		return nil, ErrNoPassphrase
+	}
+	salt := make([]byte, saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{salt: salt, aead: aead}, nil
+}
+
+// Seal encrypts plaintext
+func (s *Sealer) Seal(plaintext string) (string, error) {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := make([]byte, 0, saltLen+len(nonce)+len(plaintext)+s.aead.Overhead())
+	out = append(out, s.salt...)
+	out = append(out, nonce...)
+	out = s.aead.Seal(out, nonce, []byte(plaintext), s.salt)
+	return prefix + base64.RawURLEncoding.EncodeToString(out), nil
+}
+
+// Opener decrypts values sealed with the same passphrase
+type Opener struct {
+	passphrase string
+	mu         sync.Mutex
+	keys       map[string]cipher.AEAD
+}
+
+// NewOpener returns an Opener for passphrase
+func NewOpener(passphrase string) (*Opener, error) {
+	if passphrase == "" {
+		return nil, ErrNoPassphrase
+	}
+	return &Opener{passphrase: passphrase, keys: make(map[string]cipher.AEAD)}, nil
+}
+
+// Open decrypts a sealed value
+func (o *Opener) Open(sealed string) (string, error) {
+	if !IsSealed(sealed) {
+		return "", ErrMalformed
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(sealed, prefix))
+	if err != nil || len(raw) < saltLen {
+		return "", ErrMalformed
+	}
+	salt := raw[:saltLen]
+
+	aead, err := o.aead(salt)
+	if err != nil {
+		return "", err
+	}
+	rest := raw[saltLen:]
+	if len(rest) < aead.NonceSize()+aead.Overhead() {
+		return "", ErrMalformed
+	}
+	nonce, ciphertext := rest[:aead.NonceSize()], rest[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, salt)
+	if err != nil {
+		return "", ErrDecrypt
+	}
+	return string(plaintext), nil
+}
+
+func (o *Opener) aead(salt []byte) (cipher.AEAD, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if aead, ok := o.keys[string(salt)]; ok {
+		return aead, nil
+	}
+	aead, err := newAEAD(o.passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	o.keys[string(salt)] = aead
+	return aead, nil
+}
+
+func newAEAD(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
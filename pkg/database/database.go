@@ -1,32 +1,102 @@
 package database
 
 import (
-	"github.com/DaffaJatmiko/stream_camera/internal/domain/models"
+	"fmt"
+	"log"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/DaffaJatmiko/stream_camera/pkg/utils"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// Supported values of database.driver
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+	DriverMemory   = "memory"
+)
+
 // Definisikan struct Database
 type Database struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	Driver string
 }
 
-// Membuat koneksi ke PostgreSQL dan mengembalikan instance Database
-func NewPostgresDB() (*Database, error) {
-	dsn := "host=localhost user=postgres password=jatming dbname=keran_kitera port=5432 sslmode=disable TimeZone=Asia/Jakarta"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+// New membuka koneksi dan memastikan skema database sesuai dengan binary.
+// Migrasi yang tertunda dijalankan bila database.auto_migrate aktif.
+func New(cfg config.DatabaseConfig) (*Database, error) {
+	db, err := Open(cfg)
 	if err != nil {
 		return nil, err
 	}
+	if err := db.ensureSchema(cfg.AutoMigrate || db.Driver == DriverMemory); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Open membuka koneksi sesuai database.driver tanpa menyentuh skema
+func Open(cfg config.DatabaseConfig) (*Database, error) {
+	var dialector gorm.Dialector
+	switch cfg.Driver {
+	case DriverPostgres, "":
+		dialector = postgres.Open(cfg.DSN())
+	case DriverSQLite:
+		dialector = sqlite.Open(cfg.Path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	case DriverMemory:
+		// Each call gets its own named database, which lives as long as one
+		// connection to it is open
+		dialector = sqlite.Open("file:stream_camera_" + utils.GenerateUUID() + "?mode=memory&cache=shared")
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", cfg.Driver)
+	}
 
-	// Auto Migrate the models
-	err = db.AutoMigrate(&models.Stream{})
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, err
 	}
 
+	if cfg.Driver == DriverSQLite || cfg.Driver == DriverMemory {
+		// SQLite allows a single writer; serialise access through one connection
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, err
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+
 	// Mengembalikan instance Database
-	return &Database{DB: db}, nil
+	driver := cfg.Driver
+	if driver == "" {
+		driver = DriverPostgres
+	}
+	return &Database{DB: db, Driver: driver}, nil
+}
+
+func (db *Database) ensureSchema(autoMigrate bool) error {
+	migrator, err := db.NewMigrator()
+	if err != nil {
+		return err
+	}
+	if err := migrator.CheckCompatible(); err != nil {
+		return err
+	}
+
+	pending, err := migrator.Pending()
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	if !autoMigrate {
+		return fmt.Errorf("database has %d pending migrations; run the migrate up command", len(pending))
+	}
+	applied, err := migrator.Up()
+	for _, migration := range applied {
+		log.Printf("Applied migration %04d_%s", migration.Version, migration.Name)
+	}
+	return err
 }
 
 // Fungsi untuk menutup koneksi database
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS streams (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ,
+    deleted_at TIMESTAMPTZ,
+    uuid TEXT,
+    url TEXT,
+    on_demand BOOLEAN DEFAULT false,
+    debug BOOLEAN DEFAULT false
+);
+CREATE INDEX IF NOT EXISTS idx_streams_deleted_at ON streams (deleted_at);
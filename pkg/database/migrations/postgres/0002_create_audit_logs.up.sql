@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS audit_logs (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ,
+    actor TEXT,
+    source_ip TEXT,
+    action TEXT,
+    resource TEXT,
+    "before" TEXT,
+    "after" TEXT,
+    changes TEXT
+);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_created_at ON audit_logs (created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_actor ON audit_logs (actor);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_action ON audit_logs (action);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_resource ON audit_logs (resource);
@@ -0,0 +1,12 @@
+ALTER TABLE streams ADD COLUMN name TEXT;
+-- Streams created before uuids were enforced get one, and live streams
+-- sharing a uuid keep it on the oldest row only, so the unique index below
+-- can be built
+UPDATE streams SET uuid = upper(md5(random()::text || clock_timestamp()::text || id::text)::uuid::text) WHERE uuid = '' OR uuid IS NULL;
+UPDATE streams SET uuid = upper(md5(random()::text || clock_timestamp()::text || id::text)::uuid::text)
+WHERE deleted_at IS NULL AND id NOT IN (SELECT MIN(id) FROM streams WHERE deleted_at IS NULL GROUP BY uuid);
+CREATE UNIQUE INDEX idx_streams_uuid ON streams (uuid) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX idx_streams_name ON streams (name) WHERE deleted_at IS NULL;
+CREATE INDEX idx_streams_url ON streams (url);
+CREATE INDEX idx_streams_on_demand ON streams (on_demand);
+CREATE INDEX idx_streams_ephemeral ON streams (ephemeral);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_streams_site;
+ALTER TABLE streams DROP COLUMN metadata;
+ALTER TABLE streams DROP COLUMN tags;
+ALTER TABLE streams DROP COLUMN longitude;
+ALTER TABLE streams DROP COLUMN latitude;
+ALTER TABLE streams DROP COLUMN site;
+ALTER TABLE streams DROP COLUMN description;
+ALTER TABLE streams DROP COLUMN display_name;
@@ -0,0 +1 @@
+ALTER TABLE streams DROP COLUMN audio_transcode;
@@ -0,0 +1 @@
+ALTER TABLE streams ADD COLUMN backchannel BOOLEAN DEFAULT false;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS streams (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    created_at DATETIME,
+    updated_at DATETIME,
+    deleted_at DATETIME,
+    uuid TEXT,
+    url TEXT,
+    on_demand NUMERIC DEFAULT false,
+    debug NUMERIC DEFAULT false
+);
+CREATE INDEX IF NOT EXISTS idx_streams_deleted_at ON streams (deleted_at);
@@ -0,0 +1 @@
+ALTER TABLE streams ADD COLUMN ephemeral NUMERIC DEFAULT false;
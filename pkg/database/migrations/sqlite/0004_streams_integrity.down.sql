@@ -0,0 +1,11 @@
+-- Rolling back keeps the uuids the up migration generated for blank and
+-- duplicate streams. Applying it again repeats the same backfill:
+--   UPDATE streams SET uuid = hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(6)) WHERE uuid = '' OR uuid IS NULL
+--   UPDATE streams SET uuid = hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(2)) || '-' || hex(randomblob(6))
+--   WHERE deleted_at IS NULL AND id NOT IN (SELECT MIN(id) FROM streams WHERE deleted_at IS NULL GROUP BY uuid)
+DROP INDEX IF EXISTS idx_streams_ephemeral;
+DROP INDEX IF EXISTS idx_streams_on_demand;
+DROP INDEX IF EXISTS idx_streams_url;
+DROP INDEX IF EXISTS idx_streams_name;
+DROP INDEX IF EXISTS idx_streams_uuid;
+ALTER TABLE streams DROP COLUMN name;
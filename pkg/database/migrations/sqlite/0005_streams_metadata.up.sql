@@ -0,0 +1,8 @@
+ALTER TABLE streams ADD COLUMN display_name TEXT NOT NULL DEFAULT '';
+ALTER TABLE streams ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE streams ADD COLUMN site TEXT NOT NULL DEFAULT '';
+ALTER TABLE streams ADD COLUMN latitude REAL;
+ALTER TABLE streams ADD COLUMN longitude REAL;
+ALTER TABLE streams ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE streams ADD COLUMN metadata TEXT;
+CREATE INDEX idx_streams_site ON streams (site);
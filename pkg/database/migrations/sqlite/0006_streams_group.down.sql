@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_streams_display_name;
+DROP INDEX IF EXISTS idx_streams_group_name;
+ALTER TABLE streams DROP COLUMN group_name;
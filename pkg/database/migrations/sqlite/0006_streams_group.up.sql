@@ -0,0 +1,3 @@
+ALTER TABLE streams ADD COLUMN group_name TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_streams_group_name ON streams (group_name);
+CREATE INDEX idx_streams_display_name ON streams (display_name);
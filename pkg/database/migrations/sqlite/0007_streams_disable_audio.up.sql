@@ -0,0 +1 @@
+ALTER TABLE streams ADD COLUMN disable_audio NUMERIC DEFAULT false;
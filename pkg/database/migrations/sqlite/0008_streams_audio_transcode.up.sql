@@ -0,0 +1 @@
+ALTER TABLE streams ADD COLUMN audio_transcode TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+ALTER TABLE streams DROP COLUMN backchannel;
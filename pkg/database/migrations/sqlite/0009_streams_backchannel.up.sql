@@ -0,0 +1 @@
+ALTER TABLE streams ADD COLUMN backchannel NUMERIC DEFAULT false;
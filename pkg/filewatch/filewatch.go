@@ -0,0 +1,82 @@
+package filewatch
+
+import (
+	"os"
+	"time"
+)
+
+// Watcher polls a set of files and calls a function when any of them changes.
+// Polling keeps it working on network and container mounts where inotify
+// events are unreliable, e.g. Kubernetes secret volumes.
+type Watcher struct {
+	paths    []string
+	interval time.Duration
+	onChange func()
+	stop     chan struct{}
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+// New creates a watcher for paths. Call Start to begin polling.
+func New(interval time.Duration, onChange func(), paths ...string) *Watcher {
+	return &Watcher{
+		paths:    paths,
+		interval: interval,
+		onChange: onChange,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start polls in a background goroutine until Stop is called
+func (w *Watcher) Start() {
+	go w.run()
+}
+
+// Stop ends polling
+func (w *Watcher) Stop() {
+	close(w.stop)
+}
+
+func (w *Watcher) run() {
+	last := w.snapshot()
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			current := w.snapshot()
+			if changed(last, current) {
+				last = current
+				w.onChange()
+			}
+		}
+	}
+}
+
+func (w *Watcher) snapshot() []fileState {
+	states := make([]fileState, len(w.paths))
+	for i, path := range w.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		states[i] = fileState{modTime: info.ModTime(), size: info.Size(), exists: true}
+	}
+	return states
+}
+
+func changed(a, b []fileState) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return true
+		}
+	}
+	return false
+}
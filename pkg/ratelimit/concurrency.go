@@ -0,0 +1,48 @@
+package ratelimit
+
+import "sync"
+
+// ConcurrencyLimiter caps the number of simultaneous holders per key
+type ConcurrencyLimiter struct {
+	mu     sync.Mutex
+	max    int
+	active map[string]int
+}
+
+// NewConcurrencyLimiter creates a limiter allowing max holders per key.
+// A non-positive max returns nil, which allows everything.
+func NewConcurrencyLimiter(max int) *ConcurrencyLimiter {
+	if max <= 0 {
+		return nil
+	}
+	return &ConcurrencyLimiter{
+		max:    max,
+		active: make(map[string]int),
+	}
+}
+
+// Acquire reserves a slot for key. The returned release function must be
+// called once the slot is no longer used; it is nil when no slot was free.
+func (l *ConcurrencyLimiter) Acquire(key string) (release func(), ok bool) {
+	if l == nil {
+		return func() {}, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.active[key] >= l.max {
+		return nil, false
+	}
+	l.active[key]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			if l.active[key]--; l.active[key] <= 0 {
+				delete(l.active, key)
+			}
+		})
+	}, true
+}
@@ -0,0 +1,54 @@
+package streaming
+
+import (
+	"log"
+	"time"
+)
+
+// ephemeralGCInterval is how often idle ephemeral streams are looked for
+const ephemeralGCInterval = time.Minute
+
+// RunEphemeralGC periodically deletes ephemeral streams that have had no
+// viewers for longer than the configured idle timeout.
+func (m *Manager) RunEphemeralGC() {
+	ticker := time.NewTicker(ephemeralGCInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		m.collectEphemeralStreams()
+	}
+}
+
+func (m *Manager) collectEphemeralStreams() {
+	streams, err := m.streamRepo.GetEphemeralStreams()
+	if err != nil {
+		log.Printf("Error loading ephemeral streams: %v", err)
+		return
+	}
+
+	timeout := m.cfg.GetSourcePolicy().EphemeralIdleTimeout.Duration()
+	for _, stream := range streams {
+		idleSince, idle := m.cfg.IdleSince(stream.UUID)
+		if !idle {
+			if m.cfg.StreamExists(stream.UUID) {
+				// Viewers are still connected
+				continue
+			}
+			// Not loaded since the last restart
+			idleSince = stream.UpdatedAt
+		}
+		if idleSince.IsZero() || time.Since(idleSince) < timeout {
+			continue
+		}
+
+		if err := m.streamRepo.Delete(stream.UUID); err != nil {
+			log.Printf("Error deleting ephemeral stream %s: %v", stream.UUID, err)
+			continue
+		}
+		if err := m.streamRepo.Purge(stream.UUID); err != nil {
+			log.Printf("Error purging ephemeral stream %s: %v", stream.UUID, err)
+		}
+		m.cfg.RemoveStream(stream.UUID)
+		log.Printf("Removed idle ephemeral stream %s", stream.UUID)
+	}
+}
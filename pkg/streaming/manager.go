@@ -22,6 +22,15 @@ func NewManager(streamRepo repository.StreamRepository) *Manager {
 }
 
 func (m *Manager) Start() {
+	// Always-on streams from the config file
+	fileURLs := make(map[string]string)
+	for _, id := range m.cfg.FileStreams() {
+		if stream, exists := m.cfg.GetStream(id); exists {
+			fileURLs[stream.URL] = id
+		}
+		m.startWorker(id)
+	}
+
 	streams, err := m.streamRepo.GetNonDemandStreams()
 	if err != nil {
 		log.Printf("Error loading streams: %v", err)
@@ -29,16 +38,53 @@ func (m *Manager) Start() {
 	}
 
 	for _, stream := range streams {
+		// Streams imported from the config file are still served under
+		// their config file ID until they are removed from the file
+		if id, exists := fileURLs[stream.URL]; exists {
+			log.Printf("Stream %s is served by config file stream %s", stream.UUID, id)
+			continue
+		}
+
 		// Tambahkan stream ke config
 		m.cfg.AddStream(stream.UUID, config.StreamConfig{
-			URL:      stream.URL,
-			Status:   true,
-			OnDemand: stream.OnDemand,
-			Debug:    stream.Debug,
-			Viewers:  make(map[string]config.ViewerConfig),
+			URL:            stream.URL,
+			Status:         true,
+			OnDemand:       stream.OnDemand,
+			Debug:          stream.Debug,
+			DisableAudio:   stream.DisableAudio,
+			AudioTranscode: stream.AudioTranscode,
+			Backchannel:    stream.Backchannel,
 		})
 
 		// Start RTSP worker
-		go StartRTSPWorker(stream.UUID, stream.URL, stream.OnDemand, stream.Debug)
+		m.startWorker(stream.UUID)
+	}
+}
+
+// Reload re-reads the configuration and reconciles config file streams with
+// the running workers. On error the running configuration is unchanged.
+func (m *Manager) Reload() (*config.ReloadResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	result, err := m.cfg.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	// Workers of removed and changed streams were stopped by the reload
+	for _, id := range append(result.Added, result.Changed...) {
+		m.startWorker(id)
+	}
+	return result, nil
+}
+
+// startWorker starts the RTSP worker of an always-on stream. On-demand
+// streams are started by their first viewer.
+func (m *Manager) startWorker(streamID string) {
+	stream, exists := m.cfg.GetStream(streamID)
+	if !exists || stream.OnDemand {
+		return
 	}
+	go StartRTSPWorker(streamID, stream.URL, stream.OnDemand, stream.Debug, stream.DisableAudio, m.cfg.StreamStopped(streamID))
 }
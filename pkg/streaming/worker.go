@@ -15,34 +15,40 @@ var (
 	ErrorStreamExitNoVideoOnStream = errors.New("stream exit no video on stream")
 	ErrorStreamExitRtspDisconnect  = errors.New("stream exit rtsp disconnect")
 	ErrorStreamExitNoViewer        = errors.New("stream exit on demand no viewer")
+	ErrorStreamExitStopped         = errors.New("stream exit stopped")
 )
 
-func StartRTSPWorker(uuid string, url string, onDemand bool, debug bool) {
+// StartRTSPWorker runs the RTSP worker for a stream, reconnecting always-on
+// streams until stop is closed.
+func StartRTSPWorker(uuid string, url string, onDemand bool, debug bool, disableAudio bool, stop <-chan struct{}) {
 	for {
 		log.Println("Stream Try Connect", uuid)
-		err := RTSPWorker(uuid, url, onDemand, debug)
+		err := RTSPWorker(uuid, url, onDemand, debug, disableAudio, stop)
 		if err != nil {
 			log.Println(err)
 			config.GetInstance().SetLastError(err)
 		}
-		if onDemand {
+		if onDemand || err == ErrorStreamExitStopped {
 			return
 		}
-		time.Sleep(1 * time.Second)
+		time.Sleep(config.GetInstance().GetWorker().RetryInterval.Duration())
 	}
 }
 
-func RTSPWorker(uuid string, url string, onDemand bool, debug bool) error {
-	keyTest := time.NewTimer(20 * time.Second)
-	clientTest := time.NewTimer(20 * time.Second)
+func RTSPWorker(uuid string, url string, onDemand bool, debug bool, disableAudio bool, stop <-chan struct{}) error {
+	cfg := config.GetInstance()
+	workerCfg := cfg.GetWorker()
+
+	keyTest := time.NewTimer(workerCfg.KeyframeTimeout.Duration())
+	clientTest := time.NewTimer(workerCfg.ViewerCheckInterval.Duration())
 	defer keyTest.Stop()
 	defer clientTest.Stop()
 
 	RTSPClient, err := rtspv2.Dial(rtspv2.RTSPClientOptions{
 		URL:              url,
-		DisableAudio:     true,
-		DialTimeout:      3 * time.Second,
-		ReadWriteTimeout: 3 * time.Second,
+		DisableAudio:     disableAudio,
+		DialTimeout:      workerCfg.DialTimeout.Duration(),
+		ReadWriteTimeout: workerCfg.ReadWriteTimeout.Duration(),
 		Debug:            debug,
 	})
 	if err != nil {
@@ -50,36 +56,45 @@ func RTSPWorker(uuid string, url string, onDemand bool, debug bool) error {
 	}
 	defer RTSPClient.Close()
 
-	cfg := config.GetInstance()
-	if RTSPClient.CodecData != nil {
-		cfg.UpdateStreamCodecs(uuid, RTSPClient.CodecData)
+	cfg.SetStreamOnline(uuid, stop, true)
+	defer cfg.SetStreamOnline(uuid, stop, false)
+
+	transcoder, codecs := cfg.StartTranscoder(uuid, stop, RTSPClient.CodecData)
+	defer transcoder.Close()
+	if codecs != nil {
+		cfg.UpdateStreamCodecs(uuid, codecs)
 	}
 
 	AudioOnly := len(RTSPClient.CodecData) == 1 && RTSPClient.CodecData[0].Type().IsAudio()
 
 	for {
 		select {
+		case <-stop:
+			return ErrorStreamExitStopped
 		case <-clientTest.C:
 			if onDemand {
 				if !cfg.HasViewers(uuid) {
 					return ErrorStreamExitNoViewer
 				}
-				clientTest.Reset(20 * time.Second)
+				clientTest.Reset(workerCfg.ViewerCheckInterval.Duration())
 			}
 		case <-keyTest.C:
 			return ErrorStreamExitNoVideoOnStream
-		case signals := <-RTSPClient.Signals:
-			switch signals {
-			case rtspv2.SignalCodecUpdate:
-				cfg.UpdateStreamCodecs(uuid, RTSPClient.CodecData)
-			case rtspv2.SignalStreamRTPStop:
+		case signal := <-RTSPClient.Signals:
+			if cfg.HandleSourceSignal(uuid, signal, RTSPClient.CodecData, transcoder) {
 				return ErrorStreamExitRtspDisconnect
 			}
 		case packetAV := <-RTSPClient.OutgoingPacketQueue:
 			if AudioOnly || packetAV.IsKeyFrame {
-				keyTest.Reset(20 * time.Second)
+				keyTest.Reset(workerCfg.KeyframeTimeout.Duration())
+			}
+			packets, err := transcoder.Transcode(*packetAV)
+			if err != nil && debug {
+				log.Printf("Stream %s: audio transcode: %v", uuid, err)
+			}
+			for _, packet := range packets {
+				cfg.BroadcastPacket(uuid, packet)
 			}
-			cfg.BroadcastPacket(uuid, *packetAV)
 		}
 	}
 }
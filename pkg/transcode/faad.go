@@ -0,0 +1,88 @@
+//go:build faad
+
+package transcode
+
+/*
+#cgo LDFLAGS: -lfaad
+#include <stdlib.h>
+#include <neaacdec.h>
+
+static NeAACDecHandle faad_open(unsigned char *config, unsigned long size, unsigned long *rate, unsigned char *channels) {
+	NeAACDecHandle h = NeAACDecOpen();
+	if (h == NULL) {
+		return NULL;
+	}
+	NeAACDecConfigurationPtr conf = NeAACDecGetCurrentConfiguration(h);
+	conf->outputFormat = FAAD_FMT_16BIT;
+	conf->dontUpSampleImplicitSBR = 1;
+	NeAACDecSetConfiguration(h, conf);
+	if (NeAACDecInit2(h, config, size, rate, channels) < 0) {
+		NeAACDecClose(h);
+		return NULL;
+	}
+	return h;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+
+	"github.com/deepch/vdk/av"
+	"github.com/deepch/vdk/codec/aacparser"
+)
+
+func init() {
+	RegisterDecoder(av.AAC, newFAADDecoder)
+}
+
+// faadDecoder decodes AAC with FAAD2
+type faadDecoder struct {
+	handle C.NeAACDecHandle
+}
+
+func newFAADDecoder(codec av.AudioCodecData) (Decoder, error) {
+	aac, ok := codec.(aacparser.CodecData)
+	if !ok {
+		return nil, errors.New("faad: AAC codec data has no AudioSpecificConfig")
+	}
+	config := aac.MPEG4AudioConfigBytes()
+	if len(config) == 0 {
+		return nil, errors.New("faad: empty AudioSpecificConfig")
+	}
+
+	cConfig := C.CBytes(config)
+	defer C.free(cConfig)
+	var rate C.ulong
+	var channels C.uchar
+	handle := C.faad_open((*C.uchar)(cConfig), C.ulong(len(config)), &rate, &channels)
+	if handle == nil {
+		return nil, errors.New("faad: unsupported AudioSpecificConfig")
+	}
+	return &faadDecoder{handle: handle}, nil
+}
+
+func (d *faadDecoder) Decode(frame []byte) ([]int16, int, int, error) {
+	if len(frame) == 0 {
+		return nil, 0, 0, nil
+	}
+	cFrame := C.CBytes(frame)
+	defer C.free(cFrame)
+
+	var info C.NeAACDecFrameInfo
+	samples := C.NeAACDecDecode(d.handle, &info, (*C.uchar)(cFrame), C.ulong(len(frame)))
+	if info.error != 0 {
+		return nil, 0, 0, errors.New("faad: " + C.GoString(C.NeAACDecGetErrorMessage(info.error)))
+	}
+	if samples == nil || info.samples == 0 {
+		return nil, 0, 0, nil
+	}
+	pcm := make([]int16, int(info.samples))
+	copy(pcm, unsafe.Slice((*int16)(samples), int(info.samples)))
+	return pcm, int(info.samplerate), int(info.channels), nil
+}
+
+func (d *faadDecoder) Close() {
+	C.NeAACDecClose(d.handle)
+}
@@ -0,0 +1,131 @@
+package transcode
+
+import (
+	"github.com/deepch/vdk/av"
+	"github.com/deepch/vdk/codec"
+)
+
+const (
+	g711SampleRate = 8000
+	g711FrameSize  = 160 // 20ms
+
+	mulawBias = 0x84
+	mulawClip = 32635
+)
+
+// g711Encoder encodes A-law or µ-law (ITU-T G.711)
+type g711Encoder struct {
+	codecType av.CodecType
+}
+
+func newG711Encoder(codecType av.CodecType) *g711Encoder {
+	return &g711Encoder{codecType: codecType}
+}
+
+func (e *g711Encoder) CodecData() av.AudioCodecData {
+	if e.codecType == av.PCM_MULAW {
+		return codec.NewPCMMulawCodecData()
+	}
+	return codec.NewPCMAlawCodecData()
+}
+
+func (e *g711Encoder) SampleRate() int { return g711SampleRate }
+
+func (e *g711Encoder) FrameSize() int { return g711FrameSize }
+
+func (e *g711Encoder) Encode(pcm []int16) ([]byte, error) {
+	out := make([]byte, len(pcm))
+	for i, s := range pcm {
+		if e.codecType == av.PCM_MULAW {
+			out[i] = linearToMulaw(s)
+		} else {
+			out[i] = linearToAlaw(s)
+		}
+	}
+	return out, nil
+}
+
+func (e *g711Encoder) Close() {}
+
+func linearToAlaw(s int16) byte {
+	sample := int(s)
+	mask := byte(0xD5)
+	if sample < 0 {
+		sample = -sample - 1
+		mask = 0x55
+	}
+	if sample < 256 {
+		return byte(sample>>4) ^ mask
+	}
+	segment := 7
+	for bit := 0x4000; sample&bit == 0; bit >>= 1 {
+		segment--
+	}
+	return byte(segment<<4|(sample>>(segment+3))&0x0F) ^ mask
+}
+
+func linearToMulaw(s int16) byte {
+	sample := int(s)
+	var sign byte
+	if sample < 0 {
+		sample = -sample
+		sign = 0x80
+	}
+	if sample > mulawClip {
+		sample = mulawClip
+	}
+	sample += mulawBias
+	exponent := 7
+	for bit := 0x4000; sample&bit == 0 && exponent > 0; bit >>= 1 {
+		exponent--
+	}
+	mantissa := (sample >> (exponent + 3)) & 0x0F
+	return ^(sign | byte(exponent<<4) | byte(mantissa))
+}
+
+// g711Decoder decodes A-law or µ-law (ITU-T G.711)
+type g711Decoder struct {
+	codecType av.CodecType
+}
+
+func newG711Decoder(codecType av.CodecType) *g711Decoder {
+	return &g711Decoder{codecType: codecType}
+}
+
+func (d *g711Decoder) Decode(frame []byte) ([]int16, int, int, error) {
+	pcm := make([]int16, len(frame))
+	for i, b := range frame {
+		if d.codecType == av.PCM_MULAW {
+			pcm[i] = mulawToLinear(b)
+		} else {
+			pcm[i] = alawToLinear(b)
+		}
+	}
+	return pcm, g711SampleRate, 1, nil
+}
+
+func (d *g711Decoder) Close() {}
+
+func alawToLinear(b byte) int16 {
+	b ^= 0x55
+	segment := int(b&0x70) >> 4
+	sample := int(b&0x0F)<<4 + 8
+	if segment > 0 {
+		sample = (sample + 0x100) << (segment - 1)
+	}
+	if b&0x80 == 0 {
+		return int16(-sample)
+	}
+	return int16(sample)
+}
+
+func mulawToLinear(b byte) int16 {
+	b = ^b
+	exponent := int(b&0x70) >> 4
+	sample := (int(b&0x0F)<<3 + mulawBias) << exponent
+	sample -= mulawBias
+	if b&0x80 != 0 {
+		return int16(-sample)
+	}
+	return int16(sample)
+}
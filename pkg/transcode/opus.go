@@ -0,0 +1,110 @@
+//go:build opus
+
+package transcode
+
+/*
+#cgo pkg-config: opus
+#include <opus.h>
+
+#define OPUS_TRANSCODE_BITRATE 32000
+
+static OpusEncoder *opus_open(opus_int32 rate, int *err) {
+	OpusEncoder *enc = opus_encoder_create(rate, 1, OPUS_APPLICATION_AUDIO, err);
+	if (enc != NULL) {
+		opus_encoder_ctl(enc, OPUS_SET_BITRATE(OPUS_TRANSCODE_BITRATE));
+	}
+	return enc;
+}
+
+static int opus_decode_frame(OpusDecoder *dec, const unsigned char *data, opus_int32 len, opus_int16 *pcm, int max) {
+	return opus_decode(dec, data, len, pcm, max, 0);
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/deepch/vdk/av"
+	"github.com/deepch/vdk/codec"
+)
+
+const (
+	opusSampleRate = 48000
+	opusFrameSize  = 960 // 20ms
+	opusMaxPacket  = 1500
+	opusMaxFrame   = 5760 // 120ms, the longest Opus packet
+)
+
+func init() {
+	RegisterEncoder(TargetOpus, newOpusEncoder)
+	RegisterDecoder(av.OPUS, newOpusDecoder)
+}
+
+// opusEncoder encodes mono Opus with libopus
+type opusEncoder struct {
+	enc *C.OpusEncoder
+	buf []byte
+}
+
+func newOpusEncoder() (Encoder, error) {
+	var cErr C.int
+	enc := C.opus_open(C.opus_int32(opusSampleRate), &cErr)
+	if enc == nil || cErr != C.OPUS_OK {
+		return nil, fmt.Errorf("opus: %s", C.GoString(C.opus_strerror(cErr)))
+	}
+	return &opusEncoder{enc: enc, buf: make([]byte, opusMaxPacket)}, nil
+}
+
+func (e *opusEncoder) CodecData() av.AudioCodecData {
+	return codec.NewOpusCodecData(opusSampleRate, av.CH_MONO)
+}
+
+func (e *opusEncoder) SampleRate() int { return opusSampleRate }
+
+func (e *opusEncoder) FrameSize() int { return opusFrameSize }
+
+func (e *opusEncoder) Encode(pcm []int16) ([]byte, error) {
+	n := C.opus_encode(e.enc, (*C.opus_int16)(unsafe.Pointer(&pcm[0])), C.int(len(pcm)),
+		(*C.uchar)(unsafe.Pointer(&e.buf[0])), C.opus_int32(len(e.buf)))
+	if n < 0 {
+		return nil, fmt.Errorf("opus: %s", C.GoString(C.opus_strerror(n)))
+	}
+	return append([]byte(nil), e.buf[:n]...), nil
+}
+
+func (e *opusEncoder) Close() {
+	C.opus_encoder_destroy(e.enc)
+}
+
+// opusDecoder decodes Opus to mono with libopus
+type opusDecoder struct {
+	dec *C.OpusDecoder
+	pcm []int16
+}
+
+func newOpusDecoder(av.AudioCodecData) (Decoder, error) {
+	var cErr C.int
+	dec := C.opus_decoder_create(C.opus_int32(opusSampleRate), 1, &cErr)
+	if dec == nil || cErr != C.OPUS_OK {
+		return nil, fmt.Errorf("opus: %s", C.GoString(C.opus_strerror(cErr)))
+	}
+	return &opusDecoder{dec: dec, pcm: make([]int16, opusMaxFrame)}, nil
+}
+
+func (d *opusDecoder) Decode(frame []byte) ([]int16, int, int, error) {
+	if len(frame) == 0 {
+		return nil, opusSampleRate, 1, nil
+	}
+	n := C.opus_decode_frame(d.dec, (*C.uchar)(unsafe.Pointer(&frame[0])), C.opus_int32(len(frame)),
+		(*C.opus_int16)(unsafe.Pointer(&d.pcm[0])), C.int(len(d.pcm)))
+	if n < 0 {
+		return nil, 0, 0, fmt.Errorf("opus: %s", C.GoString(C.opus_strerror(n)))
+	}
+	return append([]int16(nil), d.pcm[:n]...), opusSampleRate, 1, nil
+}
+
+func (d *opusDecoder) Close() {
+	C.opus_decoder_destroy(d.dec)
+}
@@ -0,0 +1,88 @@
+package transcode
+
+// downmix averages interleaved channels into mono
+func downmix(pcm []int16, channels int) []int16 {
+	if channels <= 1 {
+		return pcm
+	}
+	mono := make([]int16, len(pcm)/channels)
+	for i := range mono {
+		var sum int
+		for c := 0; c < channels; c++ {
+			sum += int(pcm[i*channels+c])
+		}
+		mono[i] = int16(sum / channels)
+	}
+	return mono
+}
+
+// resampler converts mono PCM between sample rates by linear interpolation.
+// When downsampling it first averages each input sample with its
+// predecessors over one output period to limit aliasing.
+type resampler struct {
+	inRate  int
+	outRate int
+	step    float64 // input samples per output sample
+	pos     float64 // position of the next output sample; -1 is prev
+	prev    int16
+	history []int16 // last input samples, for the averaging filter
+}
+
+func newResampler(inRate, outRate int) *resampler {
+	r := &resampler{inRate: inRate, outRate: outRate, step: float64(inRate) / float64(outRate)}
+	if taps := inRate / outRate; taps > 1 {
+		r.history = make([]int16, taps-1)
+	}
+	return r
+}
+
+func (r *resampler) resample(in []int16) []int16 {
+	if r.inRate == r.outRate || len(in) == 0 {
+		return in
+	}
+	in = r.lowpass(in)
+
+	sample := func(i int) float64 {
+		if i < 0 {
+			return float64(r.prev)
+		}
+		return float64(in[i])
+	}
+	out := make([]int16, 0, int(float64(len(in))/r.step)+1)
+	for {
+		i := int(r.pos)
+		if r.pos < 0 {
+			i = -1
+		}
+		if i+1 >= len(in) {
+			break
+		}
+		frac := r.pos - float64(i)
+		out = append(out, int16(sample(i)+(sample(i+1)-sample(i))*frac))
+		r.pos += r.step
+	}
+	r.pos -= float64(len(in))
+	r.prev = in[len(in)-1]
+	return out
+}
+
+// lowpass returns the moving average of in over len(history)+1 samples
+func (r *resampler) lowpass(in []int16) []int16 {
+	if len(r.history) == 0 {
+		return in
+	}
+	taps := len(r.history) + 1
+	window := append(append([]int16(nil), r.history...), in...)
+	out := make([]int16, len(in))
+	var sum int
+	for i := 0; i < taps-1; i++ {
+		sum += int(window[i])
+	}
+	for i := range in {
+		sum += int(window[i+taps-1])
+		out[i] = int16(sum / taps)
+		sum -= int(window[i])
+	}
+	copy(r.history, window[len(window)-len(r.history):])
+	return out
+}
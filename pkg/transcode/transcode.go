@@ -0,0 +1,328 @@
+// Package transcode converts a source audio track that WebRTC cannot carry,
+// such as AAC, into Opus or G.711 between the RTSP worker and the viewers.
+//
+// The G.711 encoders and decoders are pure Go. The other decoders and the
+// Opus encoder wrap libraries and register themselves when the binary is
+// built with their tag: "faad" for the AAC decoder and "opus" for the Opus
+// encoder and decoder.
+package transcode
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/deepch/vdk/av"
+)
+
+// Targets accepted by New
+const (
+	TargetOpus = "opus"
+	TargetPCMA = "pcma"
+	TargetPCMU = "pcmu"
+)
+
+// maxTimeGap is the largest gap between source packets that is bridged by
+// the output timeline. Larger gaps restart it at the source time.
+const maxTimeGap = time.Second
+
+var (
+	ErrUnknownTarget = errors.New("audio transcode target must be opus, pcma or pcmu")
+	ErrNoDecoder     = errors.New("no decoder for the source audio codec is built in")
+	ErrNoEncoder     = errors.New("no encoder for the target audio codec is built in")
+)
+
+// Decoder decodes one compressed frame to interleaved 16-bit PCM
+type Decoder interface {
+	Decode(frame []byte) (pcm []int16, sampleRate int, channels int, err error)
+	Close()
+}
+
+// Encoder encodes mono 16-bit PCM at SampleRate in frames of FrameSize samples
+type Encoder interface {
+	CodecData() av.AudioCodecData
+	SampleRate() int
+	FrameSize() int
+	Encode(pcm []int16) ([]byte, error)
+	Close()
+}
+
+var (
+	registryMu sync.RWMutex
+	decoders   = map[av.CodecType]func(av.AudioCodecData) (Decoder, error){
+		av.PCM_ALAW:  func(av.AudioCodecData) (Decoder, error) { return newG711Decoder(av.PCM_ALAW), nil },
+		av.PCM_MULAW: func(av.AudioCodecData) (Decoder, error) { return newG711Decoder(av.PCM_MULAW), nil },
+	}
+	encoders = map[string]func() (Encoder, error){
+		TargetPCMA: func() (Encoder, error) { return newG711Encoder(av.PCM_ALAW), nil },
+		TargetPCMU: func() (Encoder, error) { return newG711Encoder(av.PCM_MULAW), nil },
+	}
+)
+
+// RegisterDecoder makes a decoder for codecType available to New
+func RegisterDecoder(codecType av.CodecType, factory func(av.AudioCodecData) (Decoder, error)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	decoders[codecType] = factory
+}
+
+// RegisterEncoder makes an encoder for target available to New
+func RegisterEncoder(target string, factory func() (Encoder, error)) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	encoders[target] = factory
+}
+
+// ValidTarget reports whether target is empty or a known target
+func ValidTarget(target string) bool {
+	switch target {
+	case "", TargetOpus, TargetPCMA, TargetPCMU:
+		return true
+	}
+	return false
+}
+
+// CheckTarget reports whether this binary can convert AAC, the source audio
+// transcoding exists for, to target. Empty targets need nothing.
+func CheckTarget(target string) error {
+	if !ValidTarget(target) {
+		return ErrUnknownTarget
+	}
+	if target == "" {
+		return nil
+	}
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if decoders[av.AAC] == nil {
+		return fmt.Errorf("%w: %v", ErrNoDecoder, av.AAC)
+	}
+	if encoders[target] == nil {
+		return fmt.Errorf("%w: %s", ErrNoEncoder, target)
+	}
+	return nil
+}
+
+// Playable reports whether WebRTC viewers can receive the audio codec as is
+func Playable(codecType av.CodecType) bool {
+	return codecType == av.PCM_ALAW || codecType == av.PCM_MULAW || codecType == av.OPUS
+}
+
+// CanDecode reports whether a decoder for codecType is built in
+func CanDecode(codecType av.CodecType) bool {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return decoders[codecType] != nil
+}
+
+// Stats describes the work done by a Transcoder
+type Stats struct {
+	Source     string    `json:"source_codec"`
+	Target     string    `json:"target_codec"`
+	FramesIn   uint64    `json:"frames_in"`
+	FramesOut  uint64    `json:"frames_out"`
+	Errors     uint64    `json:"errors"`
+	LastError  string    `json:"last_error,omitempty"`
+	CPUTimeMs  float64   `json:"cpu_time_ms"`
+	CPUPercent float64   `json:"cpu_percent"` // share of one core since Started
+	Started    time.Time `json:"started"`
+}
+
+// Transcoder replaces the audio track of a stream with the target codec
+type Transcoder struct {
+	idx     int8
+	decoder Decoder
+	encoder Encoder
+	output  av.AudioCodecData
+
+	resampler *resampler
+	pending   []int16
+	started   bool
+	lastIn    time.Duration
+	next      time.Duration
+
+	mu      sync.Mutex
+	stats   Stats
+	cpuTime time.Duration
+}
+
+// New returns a Transcoder for the first audio track of codecs. It returns
+// nil without an error when target is empty or the track is playable as is.
+func New(codecs []av.CodecData, target string) (*Transcoder, error) {
+	if target == "" {
+		return nil, nil
+	}
+	if !ValidTarget(target) {
+		return nil, ErrUnknownTarget
+	}
+
+	idx := -1
+	for i, codec := range codecs {
+		if codec.Type().IsAudio() {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 || Playable(codecs[idx].Type()) {
+		return nil, nil
+	}
+	source, ok := codecs[idx].(av.AudioCodecData)
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrNoDecoder, codecs[idx].Type())
+	}
+	return newTranscoder(int8(idx), source, target)
+}
+
+// Convert returns a Transcoder from source, the codec of the packets with
+// index 0, to target. It returns nil without an error when source already
+// is the target codec.
+func Convert(source av.AudioCodecData, target string) (*Transcoder, error) {
+	if !ValidTarget(target) || target == "" {
+		return nil, ErrUnknownTarget
+	}
+	if targetCodecs[target] == source.Type() {
+		return nil, nil
+	}
+	return newTranscoder(0, source, target)
+}
+
+// targetCodecs are the codecs the targets encode to
+var targetCodecs = map[string]av.CodecType{
+	TargetOpus: av.OPUS,
+	TargetPCMA: av.PCM_ALAW,
+	TargetPCMU: av.PCM_MULAW,
+}
+
+func newTranscoder(idx int8, source av.AudioCodecData, target string) (*Transcoder, error) {
+	registryMu.RLock()
+	newDecoder := decoders[source.Type()]
+	newEncoder := encoders[target]
+	registryMu.RUnlock()
+	if newDecoder == nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoDecoder, source.Type())
+	}
+	if newEncoder == nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoEncoder, target)
+	}
+
+	decoder, err := newDecoder(source)
+	if err != nil {
+		return nil, err
+	}
+	encoder, err := newEncoder()
+	if err != nil {
+		decoder.Close()
+		return nil, err
+	}
+	return &Transcoder{
+		idx:     idx,
+		decoder: decoder,
+		encoder: encoder,
+		output:  encoder.CodecData(),
+		stats: Stats{
+			Source:  source.Type().String(),
+			Target:  encoder.CodecData().Type().String(),
+			Started: time.Now(),
+		},
+	}, nil
+}
+
+// Apply returns codecs with the transcoded track replaced by the target
+// codec. A nil Transcoder returns codecs unchanged.
+func (t *Transcoder) Apply(codecs []av.CodecData) []av.CodecData {
+	if t == nil || int(t.idx) >= len(codecs) {
+		return codecs
+	}
+	out := append([]av.CodecData(nil), codecs...)
+	out[t.idx] = t.output
+	return out
+}
+
+// Transcode converts a packet of the transcoded track into zero or more
+// packets of the target codec. Other packets, and every packet of a nil
+// Transcoder, are returned unchanged.
+func (t *Transcoder) Transcode(pkt av.Packet) ([]av.Packet, error) {
+	if t == nil || pkt.Idx != t.idx {
+		return []av.Packet{pkt}, nil
+	}
+
+	start := time.Now()
+	out, err := t.transcode(pkt)
+	elapsed := time.Since(start)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.cpuTime += elapsed
+	t.stats.FramesIn++
+	t.stats.FramesOut += uint64(len(out))
+	if err != nil {
+		t.stats.Errors++
+		t.stats.LastError = err.Error()
+	}
+	return out, err
+}
+
+func (t *Transcoder) transcode(pkt av.Packet) ([]av.Packet, error) {
+	pcm, sampleRate, channels, err := t.decoder.Decode(pkt.Data)
+	if err != nil || len(pcm) == 0 {
+		return nil, err
+	}
+
+	// Restart the timeline on the first frame and after gaps in the source
+	if !t.started || pkt.Time < t.lastIn || pkt.Time-t.lastIn > maxTimeGap {
+		t.started = true
+		t.pending = t.pending[:0]
+		t.next = pkt.Time
+	}
+	t.lastIn = pkt.Time
+
+	if t.resampler == nil || t.resampler.inRate != sampleRate {
+		t.resampler = newResampler(sampleRate, t.encoder.SampleRate())
+	}
+	t.pending = append(t.pending, t.resampler.resample(downmix(pcm, channels))...)
+
+	frameSize := t.encoder.FrameSize()
+	frameDuration := time.Duration(frameSize) * time.Second / time.Duration(t.encoder.SampleRate())
+	var out []av.Packet
+	consumed := 0
+	defer func() {
+		// Keep the unconsumed samples at the start of the buffer
+		t.pending = t.pending[:copy(t.pending, t.pending[consumed:])]
+	}()
+	for len(t.pending)-consumed >= frameSize {
+		data, err := t.encoder.Encode(t.pending[consumed : consumed+frameSize])
+		consumed += frameSize
+		if err != nil {
+			return out, err
+		}
+		out = append(out, av.Packet{
+			Idx:      t.idx,
+			Data:     data,
+			Time:     t.next,
+			Duration: frameDuration,
+		})
+		t.next += frameDuration
+	}
+	return out, nil
+}
+
+// Stats returns a snapshot of the transcoder's counters
+func (t *Transcoder) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stats := t.stats
+	stats.CPUTimeMs = float64(t.cpuTime.Microseconds()) / 1000
+	if wall := time.Since(stats.Started); wall > 0 {
+		stats.CPUPercent = 100 * float64(t.cpuTime) / float64(wall)
+	}
+	return stats
+}
+
+// Close releases the decoder and encoder
+func (t *Transcoder) Close() {
+	if t == nil {
+		return
+	}
+	t.decoder.Close()
+	t.encoder.Close()
+}
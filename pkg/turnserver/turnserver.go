@@ -0,0 +1,210 @@
+// Package turnserver runs the embedded TURN server and issues its
+// short-lived credentials in the TURN REST API form also used by coturn:
+// the username is "<expiry unix time>:<principal>" and the password is the
+// base64 HMAC-SHA1 of the username keyed with the shared secret.
+package turnserver
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+	"github.com/pion/logging"
+	"github.com/pion/turn/v2"
+)
+
+// Credentials authorise one client on the TURN server until Expires
+type Credentials struct {
+	URLs     []string
+	Username string
+	Password string
+	Expires  time.Time
+}
+
+// Stats describes the use of the TURN server
+type Stats struct {
+	Allocations int    // relays currently allocated
+	AuthOK      uint64 // requests with valid credentials
+	AuthFailed  uint64 // requests with invalid or expired credentials
+	PeersDenied uint64 // permissions refused for a denied peer address
+}
+
+// Server is a running embedded TURN server
+type Server struct {
+	cfg    config.TURNConfig
+	urls   []string
+	server *turn.Server
+	denied []*net.IPNet
+
+	authOK      atomic.Uint64
+	authFailed  atomic.Uint64
+	peersDenied atomic.Uint64
+}
+
+// Start listens on the configured UDP and TCP address, and on the TLS
+// address with the certificate of tlsCfg when one is set
+func Start(cfg config.TURNConfig, tlsCfg config.TLSConfig) (*Server, error) {
+	relayIP := net.ParseIP(cfg.PublicIP)
+	if relayIP == nil {
+		return nil, fmt.Errorf("turn: public IP %q is not an IP address", cfg.PublicIP)
+	}
+	denied, err := deniedNetworks(cfg.DeniedPeerCIDRs)
+	if err != nil {
+		return nil, err
+	}
+	s := &Server{cfg: cfg, urls: turnURLs(cfg), denied: denied}
+
+	var closers []func() error
+	fail := func(err error) (*Server, error) {
+		for _, closeFn := range closers {
+			closeFn()
+		}
+		return nil, fmt.Errorf("turn: %w", err)
+	}
+
+	udpConn, err := net.ListenPacket("udp4", cfg.Listen)
+	if err != nil {
+		return fail(err)
+	}
+	closers = append(closers, udpConn.Close)
+	tcpListener, err := net.Listen("tcp4", cfg.Listen)
+	if err != nil {
+		return fail(err)
+	}
+	closers = append(closers, tcpListener.Close)
+
+	listeners := []turn.ListenerConfig{{Listener: tcpListener, RelayAddressGenerator: relayAddressGenerator(cfg, relayIP), PermissionHandler: s.permit}}
+	if cfg.TLSListen != "" {
+		cert, err := tls.LoadX509KeyPair(tlsCfg.CertFile, tlsCfg.KeyFile)
+		if err != nil {
+			return fail(err)
+		}
+		tlsListener, err := tls.Listen("tcp4", cfg.TLSListen, &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			MinVersion:   tls.VersionTLS12,
+		})
+		if err != nil {
+			return fail(err)
+		}
+		closers = append(closers, tlsListener.Close)
+		listeners = append(listeners, turn.ListenerConfig{Listener: tlsListener, RelayAddressGenerator: relayAddressGenerator(cfg, relayIP), PermissionHandler: s.permit})
+	}
+
+	s.server, err = turn.NewServer(turn.ServerConfig{
+		Realm:             cfg.Realm,
+		AuthHandler:       s.authenticate,
+		LoggerFactory:     logging.NewDefaultLoggerFactory(),
+		PacketConnConfigs: []turn.PacketConnConfig{{PacketConn: udpConn, RelayAddressGenerator: relayAddressGenerator(cfg, relayIP), PermissionHandler: s.permit}},
+		ListenerConfigs:   listeners,
+	})
+	if err != nil {
+		return fail(err)
+	}
+	return s, nil
+}
+
+func relayAddressGenerator(cfg config.TURNConfig, relayIP net.IP) turn.RelayAddressGenerator {
+	if cfg.RelayPortMin > 0 {
+		return &turn.RelayAddressGeneratorPortRange{
+			RelayAddress: relayIP,
+			Address:      "0.0.0.0",
+			MinPort:      cfg.RelayPortMin,
+			MaxPort:      cfg.RelayPortMax,
+		}
+	}
+	return &turn.RelayAddressGeneratorStatic{RelayAddress: relayIP, Address: "0.0.0.0"}
+}
+
+// turnURLs returns the URLs clients reach the server at
+func turnURLs(cfg config.TURNConfig) []string {
+	host := cfg.Host
+	if host == "" {
+		host = cfg.PublicIP
+	}
+	_, port, _ := net.SplitHostPort(cfg.Listen)
+	urls := []string{
+		"turn:" + net.JoinHostPort(host, port) + "?transport=udp",
+		"turn:" + net.JoinHostPort(host, port) + "?transport=tcp",
+	}
+	if cfg.TLSListen != "" {
+		_, tlsPort, _ := net.SplitHostPort(cfg.TLSListen)
+		urls = append(urls, "turns:"+net.JoinHostPort(host, tlsPort)+"?transport=tcp")
+	}
+	return urls
+}
+
+// Credentials issues credentials for principal, valid for the configured TTL
+func (s *Server) Credentials(principal string) Credentials {
+	expires := time.Now().Add(s.cfg.CredentialTTL.Duration()).Truncate(time.Second)
+	username := strconv.FormatInt(expires.Unix(), 10) + ":" + principal
+	return Credentials{
+		URLs:     s.urls,
+		Username: username,
+		Password: sign(s.cfg.Secret, username),
+		Expires:  expires,
+	}
+}
+
+// Stats returns the current use of the server
+func (s *Server) Stats() Stats {
+	return Stats{
+		Allocations: s.server.AllocationCount(),
+		AuthOK:      s.authOK.Load(),
+		AuthFailed:  s.authFailed.Load(),
+		PeersDenied: s.peersDenied.Load(),
+	}
+}
+
+// Close stops the server and its listeners
+func (s *Server) Close() error {
+	return s.server.Close()
+}
+
+func deniedNetworks(cidrs []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("turn: denied peer cidr %q: %w", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// permit refuses to relay to peers in the denied networks, so clients
+// cannot reach the server's own host or private network through it
+func (s *Server) permit(_ net.Addr, peerIP net.IP) bool {
+	for _, network := range s.denied {
+		if network.Contains(peerIP) {
+			s.peersDenied.Add(1)
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) authenticate(username string, realm string, _ net.Addr) ([]byte, bool) {
+	expiry, _, _ := strings.Cut(username, ":")
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		s.authFailed.Add(1)
+		return nil, false
+	}
+	s.authOK.Add(1)
+	return turn.GenerateAuthKey(username, realm, sign(s.cfg.Secret, username)), true
+}
+
+func sign(secret string, username string) string {
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,48 @@
+package turnserver
+
+import (
+	"net"
+	"testing"
+
+	"github.com/DaffaJatmiko/stream_camera/pkg/config"
+)
+
+func TestPermitDeniesPrivatePeers(t *testing.T) {
+	tests := []struct {
+		name   string
+		cidrs  []string
+		peer   string
+		permit bool
+	}{
+		{"loopback", nil, "127.0.0.1", false},
+		{"private 10/8", nil, "10.1.2.3", false},
+		{"private 192.168/16", nil, "192.168.1.1", false},
+		{"cloud metadata", nil, "169.254.169.254", false},
+		{"ipv6 loopback", nil, "::1", false},
+		{"ipv6 link-local", nil, "fe80::1", false},
+		{"public ipv4", nil, "8.8.8.8", true},
+		{"public ipv6", nil, "2001:4860:4860::8888", true},
+		{"every peer allowed with an empty list", []string{}, "127.0.0.1", true},
+		{"custom list", []string{"203.0.113.0/24"}, "203.0.113.5", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cidrs := tt.cidrs
+			if cidrs == nil {
+				cidrs = config.GetInstance().GetTURN().DeniedPeerCIDRs
+			}
+			denied, err := deniedNetworks(cidrs)
+			if err != nil {
+				t.Fatalf("parse denied networks: %v", err)
+			}
+			s := &Server{denied: denied}
+
+			if got := s.permit(nil, net.ParseIP(tt.peer)); got != tt.permit {
+				t.Errorf("permit(%s) = %v, want %v", tt.peer, got, tt.permit)
+			}
+			if wantDenied := map[bool]uint64{true: 0, false: 1}[tt.permit]; s.peersDenied.Load() != wantDenied {
+				t.Errorf("peers denied = %d, want %d", s.peersDenied.Load(), wantDenied)
+			}
+		})
+	}
+}
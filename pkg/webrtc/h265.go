@@ -0,0 +1,73 @@
+package webrtc
+
+import (
+	"github.com/deepch/vdk/codec/h265parser"
+)
+
+// h265FragmentationUnit is the RTP payload type of an FU (RFC 7798 4.4.3)
+const h265FragmentationUnit = 49
+
+// h265Payloader packetizes one H.265 NAL unit as a single NAL unit packet,
+// or as fragmentation units when it does not fit into one packet
+type h265Payloader struct{}
+
+func (p *h265Payloader) Payload(mtu uint16, nalu []byte) [][]byte {
+	if len(nalu) < 3 {
+		return nil
+	}
+	if len(nalu) <= int(mtu) {
+		return [][]byte{append([]byte(nil), nalu...)}
+	}
+
+	// The payload header replaces the NAL unit header, keeping its F,
+	// layer and temporal ID bits
+	header := []byte{nalu[0]&0x81 | h265FragmentationUnit<<1, nalu[1]}
+	naluType := (nalu[0] >> 1) & 0x3f
+	data := nalu[2:]
+	maxFragment := int(mtu) - 3
+
+	var out [][]byte
+	for first := true; len(data) > 0; first = false {
+		size := maxFragment
+		if size > len(data) {
+			size = len(data)
+		}
+		fu := naluType
+		if first {
+			fu |= 0x80
+		}
+		if size == len(data) {
+			fu |= 0x40
+		}
+		packet := make([]byte, 0, size+3)
+		packet = append(packet, header[0], header[1], fu)
+		out = append(out, append(packet, data[:size]...))
+		data = data[size:]
+	}
+	return out
+}
+
+// h265NALUs splits an access unit into NAL units, putting the parameter
+// sets in front of IRAP pictures when the source does not send them in-band
+func h265NALUs(codec h265parser.CodecData, data []byte) [][]byte {
+	nalus, _ := h265parser.SplitNALUs(data)
+
+	var hasParameterSets bool
+	out := make([][]byte, 0, len(nalus)+3)
+	for _, nalu := range nalus {
+		if len(nalu) < 2 {
+			continue
+		}
+		switch naluType := int(nalu[0]>>1) & 0x3f; {
+		case naluType == h265parser.NAL_UNIT_VPS || naluType == h265parser.NAL_UNIT_SPS:
+			hasParameterSets = true
+		case naluType >= h265parser.NAL_UNIT_CODED_SLICE_BLA_W_LP && naluType <= h265parser.NAL_UNIT_CODED_SLICE_CRA:
+			if !hasParameterSets {
+				out = append(out, codec.VPS(), codec.SPS(), codec.PPS())
+				hasParameterSets = true
+			}
+		}
+		out = append(out, nalu)
+	}
+	return out
+}
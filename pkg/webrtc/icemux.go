@@ -0,0 +1,75 @@
+package webrtc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/pion/ice/v2"
+	"github.com/pion/logging"
+	"github.com/pion/webrtc/v3"
+)
+
+// iceTCPReadBufferSize is the number of packets buffered per ICE-TCP
+// connection before the peer connection reads them
+const iceTCPReadBufferSize = 8
+
+// ICEMux lets the peer connections of all muxers share one UDP port and,
+// optionally, one ICE-TCP port, so only those need to be opened in
+// firewalls. Peers are told apart by their ICE username fragment.
+type ICEMux struct {
+	udp ice.UDPMux
+	tcp ice.TCPMux
+}
+
+// NewICEMux listens on udpPort and tcpPort on all interfaces. A zero port
+// leaves that transport to the per-session defaults: ephemeral UDP ports,
+// and no ICE-TCP.
+func NewICEMux(udpPort uint16, tcpPort uint16) (*ICEMux, error) {
+	loggerFactory := logging.NewDefaultLoggerFactory()
+	m := &ICEMux{}
+	if udpPort > 0 {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: int(udpPort)})
+		if err != nil {
+			return nil, fmt.Errorf("ICE UDP mux: %w", err)
+		}
+		m.udp = webrtc.NewICEUDPMux(loggerFactory.NewLogger("ice-udp-mux"), conn)
+	}
+	if tcpPort > 0 {
+		listener, err := net.Listen("tcp", ":"+strconv.Itoa(int(tcpPort)))
+		if err != nil {
+			m.Close()
+			return nil, fmt.Errorf("ICE TCP mux: %w", err)
+		}
+		m.tcp = webrtc.NewICETCPMux(loggerFactory.NewLogger("ice-tcp-mux"), listener, iceTCPReadBufferSize)
+	}
+	return m, nil
+}
+
+// apply makes the peer connections of s use the shared ports
+func (m *ICEMux) apply(s *webrtc.SettingEngine) {
+	if m.udp != nil {
+		s.SetICEUDPMux(m.udp)
+	}
+	if m.tcp != nil {
+		s.SetICETCPMux(m.tcp)
+		s.SetNetworkTypes([]webrtc.NetworkType{
+			webrtc.NetworkTypeUDP4, webrtc.NetworkTypeUDP6,
+			webrtc.NetworkTypeTCP4, webrtc.NetworkTypeTCP6,
+		})
+	}
+}
+
+// Close stops listening
+func (m *ICEMux) Close() error {
+	var err error
+	if m.udp != nil {
+		err = m.udp.Close()
+	}
+	if m.tcp != nil {
+		if tcpErr := m.tcp.Close(); err == nil {
+			err = tcpErr
+		}
+	}
+	return err
+}
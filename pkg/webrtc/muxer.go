@@ -0,0 +1,651 @@
+// Package webrtc sends av.Packet streams to a browser over a WebRTC peer
+// connection. It keeps the API of vdk's webrtcv3 muxer, which it replaces,
+// but stamps RTP timestamps from the packet times so audio and video stay
+// in sync.
+package webrtc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/deepch/vdk/av"
+	"github.com/deepch/vdk/codec/h264parser"
+	"github.com/deepch/vdk/codec/h265parser"
+	"github.com/pion/interceptor"
+	rtpstats "github.com/pion/interceptor/pkg/stats"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// rtpOutboundMTU matches pion's sample tracks
+	rtpOutboundMTU = 1200
+
+	// maxTimestampJump is the largest gap between two packets of a track
+	// that is taken from the packet times. Larger or negative gaps, e.g.
+	// after the source timestamp wraps, advance by the packet duration.
+	maxTimestampJump = 10 * time.Second
+
+	// replaySpacing separates the packets of a replay on the RTP timeline
+	replaySpacing = time.Millisecond
+
+	// mediaStreamID puts all tracks in one MediaStream so browsers
+	// synchronise their playback
+	mediaStreamID = "stream"
+
+	gatherTimeout = 10 * time.Second
+
+	// h265PayloadType is offered for H.265, which pion does not register
+	h265PayloadType = 126
+)
+
+var (
+	ErrorNotFound          = errors.New("WebRTC Stream Not Found")
+	ErrorCodecNotSupported = errors.New("WebRTC Codec Not Supported")
+	ErrorClientOffline     = errors.New("WebRTC Client Offline")
+	ErrorNotTrackAvailable = errors.New("WebRTC Not Track Available")
+	// ErrorClientCodecUnsupported is returned by WriteHeader when the offer
+	// does not include the codec of the stream's video
+	ErrorClientCodecUnsupported = errors.New("WebRTC client cannot play the stream's video codec")
+)
+
+// Options configures the peer connection of a Muxer
+type Options struct {
+	// ICEServers are the STUN or TURN server URLs offered to the peer
+	ICEServers []string
+	// ICEUsername authenticates with the ICEServers
+	ICEUsername string
+	// ICECredential is the password for ICEUsername
+	ICECredential string
+	// RelayServers are TURN servers with their own credentials, used in
+	// addition to ICEServers
+	RelayServers []webrtc.ICEServer
+	// ICECandidates are external 1:1 NAT IP addresses to advertise
+	ICECandidates []string
+	// PortMin and PortMax bound the ephemeral UDP port range
+	PortMin uint16
+	PortMax uint16
+	// Mux, when set, carries host candidates on ports shared by all muxers
+	Mux *ICEMux
+	// OnKeyframeRequest is called when the viewer sends a PLI or FIR for
+	// the video track, in addition to signalling KeyframeRequests
+	OnKeyframeRequest func()
+	// OnICECandidate enables trickle ICE: WriteHeader and Restart answer
+	// without waiting for gathering and each local candidate is passed
+	// here, followed by nil when gathering completes
+	OnICECandidate func(candidate *webrtc.ICECandidateInit)
+	// ReconnectTimeout keeps the muxer open this long after ICE disconnects
+	// or fails, so that the peer can restart ICE. Zero closes it at once.
+	ReconnectTimeout time.Duration
+	// OnAudio, when set, accepts the audio the peer sends, such as a
+	// microphone. It is called in its own goroutine for each audio track and
+	// may read the track until ReadPacket fails.
+	OnAudio func(track *AudioTrack)
+}
+
+// Muxer writes the packets of one stream to one peer connection
+type Muxer struct {
+	Options Options
+
+	mu      sync.Mutex
+	streams map[int8]*track
+	status  webrtc.ICEConnectionState
+	stop    bool
+	pc      *webrtc.PeerConnection
+	// reconnect closes the muxer unless ICE connects again in time
+	reconnect *time.Timer
+	// stats is the stats interceptor of pc
+	stats     rtpstats.Getter
+	connected time.Time
+	// rate samples the outgoing bitrate of pc
+	rate *bitrateInterceptor
+	// keyframeRequests signals PLI and FIR from the viewer
+	keyframeRequests chan struct{}
+}
+
+// track is one outgoing RTP track fed by the source stream at its index
+type track struct {
+	codec      av.CodecData
+	local      *webrtc.TrackLocalStaticRTP
+	ssrc       uint32
+	packetizer rtp.Packetizer
+	clockRate  uint32
+
+	started  bool
+	lastTime time.Duration
+	elapsed  time.Duration
+	base     uint32
+
+	// replayed is set after a replay ending at replayedUntil, while packets
+	// the replay already sent may still be queued for the viewer
+	replayed      bool
+	replayedUntil time.Duration
+}
+
+// NewMuxer creates a muxer; WriteHeader negotiates its peer connection
+func NewMuxer(options Options) *Muxer {
+	return &Muxer{Options: options, streams: make(map[int8]*track), keyframeRequests: make(chan struct{}, 1)}
+}
+
+// NewPeerConnection creates a peer connection configured from the options
+func (element *Muxer) NewPeerConnection(configuration webrtc.Configuration) (*webrtc.PeerConnection, error) {
+	if len(element.Options.ICEServers) > 0 {
+		configuration.ICEServers = append(configuration.ICEServers, webrtc.ICEServer{
+			URLs:           element.Options.ICEServers,
+			Username:       element.Options.ICEUsername,
+			Credential:     element.Options.ICECredential,
+			CredentialType: webrtc.ICECredentialTypePassword,
+		})
+	} else {
+		configuration.ICEServers = append(configuration.ICEServers, webrtc.ICEServer{
+			URLs: []string{"stun:stun.l.google.com:19302"},
+		})
+	}
+	configuration.ICEServers = append(configuration.ICEServers, element.Options.RelayServers...)
+	m := &webrtc.MediaEngine{}
+	if err := m.RegisterDefaultCodecs(); err != nil {
+		return nil, err
+	}
+	if err := m.RegisterCodec(webrtc.RTPCodecParameters{
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:     webrtc.MimeTypeH265,
+			ClockRate:    90000,
+			RTCPFeedback: []webrtc.RTCPFeedback{{Type: "goog-remb"}, {Type: "ccm", Parameter: "fir"}, {Type: "nack"}, {Type: "nack", Parameter: "pli"}},
+		},
+		PayloadType: h265PayloadType,
+	}, webrtc.RTPCodecTypeVideo); err != nil {
+		return nil, err
+	}
+	i := &interceptor.Registry{}
+	if err := webrtc.RegisterDefaultInterceptors(m, i); err != nil {
+		return nil, err
+	}
+	statsInterceptor, err := rtpstats.NewInterceptor()
+	if err != nil {
+		return nil, err
+	}
+	statsInterceptor.OnNewPeerConnection(func(_ string, getter rtpstats.Getter) {
+		element.mu.Lock()
+		element.stats = getter
+		element.mu.Unlock()
+	})
+	i.Add(statsInterceptor)
+	i.Add(bitrateFactory{onNew: func(rate *bitrateInterceptor) {
+		element.mu.Lock()
+		element.rate = rate
+		element.mu.Unlock()
+	}})
+	s := webrtc.SettingEngine{}
+	if element.Options.PortMin > 0 && element.Options.PortMax > element.Options.PortMin {
+		s.SetEphemeralUDPPortRange(element.Options.PortMin, element.Options.PortMax)
+	}
+	if len(element.Options.ICECandidates) > 0 {
+		s.SetNAT1To1IPs(element.Options.ICECandidates, webrtc.ICECandidateTypeHost)
+	}
+	if element.Options.Mux != nil {
+		element.Options.Mux.apply(&s)
+	}
+	api := webrtc.NewAPI(webrtc.WithMediaEngine(m), webrtc.WithInterceptorRegistry(i), webrtc.WithSettingEngine(s))
+	return api.NewPeerConnection(configuration)
+}
+
+// WriteHeader adds a track for every supported codec, answers the base64
+// SDP offer and returns the base64 answer. Packets are matched to tracks by
+// their index in streams.
+func (element *Muxer) WriteHeader(streams []av.CodecData, sdp64 string) (answer string, err error) {
+	if len(streams) == 0 {
+		return "", ErrorNotFound
+	}
+	sdpB, err := base64.StdEncoding.DecodeString(sdp64)
+	if err != nil {
+		return "", err
+	}
+	for _, codec := range streams {
+		if codec.Type() == av.H265 && !OfferHasCodec(string(sdpB), "H265") {
+			return "", fmt.Errorf("%w: %v", ErrorClientCodecUnsupported, codec.Type())
+		}
+	}
+	peerConnection, err := element.NewPeerConnection(webrtc.Configuration{
+		SDPSemantics: webrtc.SDPSemanticsUnifiedPlanWithFallback,
+	})
+	if err != nil {
+		return "", err
+	}
+	element.mu.Lock()
+	element.pc = peerConnection
+	element.mu.Unlock()
+	defer func() {
+		if err != nil {
+			element.Close()
+		}
+	}()
+
+	for i, codec := range streams {
+		t, err := newTrack(codec)
+		if errors.Is(err, ErrorCodecNotSupported) {
+			log.Printf("WebRTC ignores unsupported %v track", codec.Type())
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		rtpSender, err := peerConnection.AddTrack(t.local)
+		if err != nil {
+			return "", err
+		}
+		var onKeyframeRequest func()
+		if codec.Type().IsVideo() {
+			onKeyframeRequest = element.keyframeRequested
+		}
+		go readRTCP(rtpSender, onKeyframeRequest)
+		if encodings := rtpSender.GetParameters().Encodings; len(encodings) > 0 {
+			t.ssrc = uint32(encodings[0].SSRC)
+		}
+		element.streams[int8(i)] = t
+	}
+	if len(element.streams) == 0 {
+		return "", ErrorNotTrackAvailable
+	}
+	if element.Options.OnAudio != nil {
+		if err := element.acceptAudio(peerConnection); err != nil {
+			return "", err
+		}
+	}
+
+	peerConnection.OnICEConnectionStateChange(element.onICEConnectionStateChange)
+	if onCandidate := element.Options.OnICECandidate; onCandidate != nil {
+		peerConnection.OnICECandidate(func(candidate *webrtc.ICECandidate) {
+			if candidate == nil {
+				onCandidate(nil)
+				return
+			}
+			init := candidate.ToJSON()
+			onCandidate(&init)
+		})
+	}
+	return element.answer(peerConnection, string(sdpB))
+}
+
+// Restart answers a new base64 SDP offer from the peer, typically one that
+// restarts ICE after a network change, and returns the base64 answer
+func (element *Muxer) Restart(sdp64 string) (string, error) {
+	sdpB, err := base64.StdEncoding.DecodeString(sdp64)
+	if err != nil {
+		return "", err
+	}
+	element.mu.Lock()
+	stop, peerConnection := element.stop, element.pc
+	element.mu.Unlock()
+	if stop || peerConnection == nil {
+		return "", ErrorClientOffline
+	}
+	return element.answer(peerConnection, string(sdpB))
+}
+
+// AddICECandidate adds a trickled remote candidate
+func (element *Muxer) AddICECandidate(candidate webrtc.ICECandidateInit) error {
+	element.mu.Lock()
+	stop, peerConnection := element.stop, element.pc
+	element.mu.Unlock()
+	if stop || peerConnection == nil {
+		return ErrorClientOffline
+	}
+	return peerConnection.AddICECandidate(candidate)
+}
+
+// SelectedCandidatePair returns the ICE candidate pair in use, or nil
+// before ICE connects
+func (element *Muxer) SelectedCandidatePair() *webrtc.ICECandidatePair {
+	element.mu.Lock()
+	peerConnection := element.pc
+	element.mu.Unlock()
+	if peerConnection == nil {
+		return nil
+	}
+	pair, err := peerConnection.SCTP().Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil {
+		return nil
+	}
+	return pair
+}
+
+// Relayed reports whether the media goes through a TURN relay
+func (element *Muxer) Relayed() bool {
+	pair := element.SelectedCandidatePair()
+	return pair != nil && (pair.Local.Typ == webrtc.ICECandidateTypeRelay || pair.Remote.Typ == webrtc.ICECandidateTypeRelay)
+}
+
+// answer applies the offer and returns the base64 answer, once gathering
+// completes unless candidates are trickled
+func (element *Muxer) answer(peerConnection *webrtc.PeerConnection, sdp string) (string, error) {
+	offer := webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: sdp}
+	if err := peerConnection.SetRemoteDescription(offer); err != nil {
+		return "", err
+	}
+	gatherComplete := webrtc.GatheringCompletePromise(peerConnection)
+	local, err := peerConnection.CreateAnswer(nil)
+	if err != nil {
+		return "", err
+	}
+	if err = peerConnection.SetLocalDescription(local); err != nil {
+		return "", err
+	}
+
+	if element.Options.OnICECandidate == nil {
+		wait := time.NewTimer(gatherTimeout)
+		defer wait.Stop()
+		select {
+		case <-wait.C:
+			return "", errors.New("timed out gathering ICE candidates")
+		case <-gatherComplete:
+		}
+	}
+	return base64.StdEncoding.EncodeToString([]byte(peerConnection.LocalDescription().SDP)), nil
+}
+
+func (element *Muxer) onICEConnectionStateChange(state webrtc.ICEConnectionState) {
+	element.mu.Lock()
+	defer element.mu.Unlock()
+	element.status = state
+
+	switch state {
+	case webrtc.ICEConnectionStateConnected:
+		if element.connected.IsZero() {
+			element.connected = time.Now()
+		}
+		if element.reconnect != nil {
+			element.reconnect.Stop()
+			element.reconnect = nil
+		}
+	case webrtc.ICEConnectionStateDisconnected, webrtc.ICEConnectionStateFailed:
+		if element.Options.ReconnectTimeout <= 0 {
+			go element.Close()
+		} else if element.reconnect == nil {
+			element.reconnect = time.AfterFunc(element.Options.ReconnectTimeout, func() {
+				log.Printf("WebRTC peer did not reconnect within %v", element.Options.ReconnectTimeout)
+				element.Close()
+			})
+		}
+	}
+}
+
+// KeyframeRequests receives a value when the viewer asks for a keyframe.
+// Requests arriving before the previous one was received are merged.
+func (element *Muxer) KeyframeRequests() <-chan struct{} {
+	return element.keyframeRequests
+}
+
+func (element *Muxer) keyframeRequested() {
+	select {
+	case element.keyframeRequests <- struct{}{}:
+	default:
+	}
+	if element.Options.OnKeyframeRequest != nil {
+		element.Options.OnKeyframeRequest()
+	}
+}
+
+// WritePacket sends pkt on the track of pkt.Idx. Packets are dropped until
+// ICE connects; an error closes the muxer.
+func (element *Muxer) WritePacket(pkt av.Packet) error {
+	return element.writePacket(pkt, false)
+}
+
+// WriteReplay sends packets the viewer was already sent again, such as the
+// frames since the last keyframe after the viewer lost some of them. They
+// are stamped replaySpacing apart after the last packet written, so the
+// viewer decodes them at once instead of adding their duration to its
+// playout delay. Packets of the same tracks passed to WritePacket later are
+// dropped until one is newer than the replay.
+func (element *Muxer) WriteReplay(packets []av.Packet) error {
+	for _, pkt := range packets {
+		if err := element.writePacket(pkt, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (element *Muxer) writePacket(pkt av.Packet, replay bool) (err error) {
+	element.mu.Lock()
+	stop, status := element.stop, element.status
+	t, ok := element.streams[pkt.Idx]
+	element.mu.Unlock()
+
+	if stop {
+		return ErrorClientOffline
+	}
+	if status != webrtc.ICEConnectionStateConnected || !ok || len(pkt.Data) == 0 {
+		return nil
+	}
+	defer func() {
+		if err != nil {
+			element.Close()
+		}
+	}()
+
+	var payloads [][]byte
+	// Video packets carry a 4 byte length prefix and a NAL header; audio
+	// frames such as Opus silence may be shorter
+	if t.codec.Type().IsVideo() && len(pkt.Data) < 5 {
+		return nil
+	}
+	if replay {
+		t.replayed, t.replayedUntil = true, pkt.Time
+	} else if t.skipReplayed(pkt) {
+		return nil
+	}
+	switch t.codec.Type() {
+	case av.H264:
+		payloads = [][]byte{annexB(t.codec.(h264parser.CodecData), pkt.Data)}
+	case av.H265:
+		payloads = h265NALUs(t.codec.(h265parser.CodecData), pkt.Data)
+	default:
+		payloads = [][]byte{pkt.Data}
+	}
+
+	var packets []*rtp.Packet
+	for _, payload := range payloads {
+		packets = append(packets, t.packetizer.Packetize(payload, 0)...)
+	}
+	timestamp := t.timestamp(pkt, replay)
+	for i, packet := range packets {
+		packet.Timestamp = timestamp
+		packet.Marker = i == len(packets)-1
+		if err := t.local.WriteRTP(packet); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the peer connection
+func (element *Muxer) Close() error {
+	element.mu.Lock()
+	element.stop = true
+	pc := element.pc
+	if element.reconnect != nil {
+		element.reconnect.Stop()
+		element.reconnect = nil
+	}
+	element.mu.Unlock()
+	if pc != nil {
+		return pc.Close()
+	}
+	return nil
+}
+
+func newTrack(codec av.CodecData) (*track, error) {
+	var capability webrtc.RTPCodecCapability
+	var payloader rtp.Payloader
+	switch codec.Type() {
+	case av.H264:
+		capability = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH264, ClockRate: 90000}
+		payloader = &codecs.H264Payloader{}
+	case av.H265:
+		capability = webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeH265, ClockRate: 90000}
+		payloader = &h265Payloader{}
+	case av.PCM_ALAW, av.PCM_MULAW:
+		mime := webrtc.MimeTypePCMA
+		if codec.Type() == av.PCM_MULAW {
+			mime = webrtc.MimeTypePCMU
+		}
+		audio := codec.(av.AudioCodecData)
+		capability = webrtc.RTPCodecCapability{
+			MimeType:  mime,
+			ClockRate: uint32(audio.SampleRate()),
+			Channels:  uint16(audio.ChannelLayout().Count()),
+		}
+		payloader = &codecs.G711Payloader{}
+	case av.OPUS:
+		// Opus always uses a 48kHz RTP clock
+		capability = webrtc.RTPCodecCapability{
+			MimeType:  webrtc.MimeTypeOpus,
+			ClockRate: 48000,
+			Channels:  2,
+		}
+		payloader = &codecs.OpusPayloader{}
+	default:
+		return nil, ErrorCodecNotSupported
+	}
+
+	kind := "audio"
+	if codec.Type().IsVideo() {
+		kind = "video"
+	}
+	local, err := webrtc.NewTrackLocalStaticRTP(capability, kind, mediaStreamID)
+	if err != nil {
+		return nil, err
+	}
+	// The track rewrites payload type and SSRC for each peer binding
+	packetizer := rtp.NewPacketizer(rtpOutboundMTU, 0, 0, payloader, rtp.NewRandomSequencer(), capability.ClockRate)
+	return &track{
+		codec:      codec,
+		local:      local,
+		packetizer: packetizer,
+		clockRate:  capability.ClockRate,
+		base:       rand.Uint32(),
+	}, nil
+}
+
+// timestamp returns the RTP timestamp of pkt. It follows the gaps between
+// packet times rather than summing durations, which rtspv2 truncates to
+// milliseconds for video and which miss packets dropped for slow viewers.
+// Replayed packets advance the timeline by replaySpacing only.
+func (t *track) timestamp(pkt av.Packet, replay bool) uint32 {
+	if t.started {
+		delta := pkt.Time - t.lastTime
+		switch {
+		case replay:
+			delta = replaySpacing
+		case delta < 0 || delta > maxTimestampJump:
+			delta = pkt.Duration
+		}
+		t.elapsed += delta
+	}
+	t.started = true
+	t.lastTime = pkt.Time
+	return t.base + uint32(t.elapsed.Microseconds()*int64(t.clockRate)/int64(time.Second/time.Microsecond))
+}
+
+// skipReplayed reports whether pkt was already sent by the last replay.
+// Packets queued before the replay are at most as new as its last packet; a
+// newer packet, or a much older one after the source restarted, ends the
+// check.
+func (t *track) skipReplayed(pkt av.Packet) bool {
+	if !t.replayed {
+		return false
+	}
+	if pkt.Time <= t.replayedUntil && t.replayedUntil-pkt.Time <= maxTimestampJump {
+		return true
+	}
+	t.replayed = false
+	return false
+}
+
+// annexB converts an access unit to Annex B, putting the parameter sets in
+// front of IDR slices when the source does not send them in-band.
+func annexB(codec h264parser.CodecData, data []byte) []byte {
+	nalus, _ := h264parser.SplitNALUs(data)
+	startCode := []byte{0, 0, 0, 1}
+
+	var hasSPS bool
+	var buf bytes.Buffer
+	for _, nalu := range nalus {
+		if len(nalu) == 0 {
+			continue
+		}
+		switch nalu[0] & 0x1f {
+		case h264parser.NALU_SPS:
+			hasSPS = true
+		case 5:
+			if !hasSPS {
+				buf.Write(startCode)
+				buf.Write(codec.SPS())
+				buf.Write(startCode)
+				buf.Write(codec.PPS())
+				hasSPS = true
+			}
+		}
+		buf.Write(startCode)
+		buf.Write(nalu)
+	}
+	return buf.Bytes()
+}
+
+// OfferCodecs returns the codec names of an SDP offer's rtpmap lines,
+// e.g. "H264" or "opus", in order and possibly repeated
+func OfferCodecs(sdp string) []string {
+	var codecs []string
+	for _, line := range strings.Split(sdp, "\n") {
+		rtpmap, ok := strings.CutPrefix(strings.TrimSpace(line), "a=rtpmap:")
+		if !ok {
+			continue
+		}
+		if _, encoding, ok := strings.Cut(rtpmap, " "); ok {
+			name, _, _ := strings.Cut(encoding, "/")
+			codecs = append(codecs, name)
+		}
+	}
+	return codecs
+}
+
+// OfferHasCodec reports whether an SDP offer lists the codec, named as in
+// its rtpmap lines (e.g. "H265")
+func OfferHasCodec(sdp string, codec string) bool {
+	for _, name := range OfferCodecs(sdp) {
+		if strings.EqualFold(name, codec) {
+			return true
+		}
+	}
+	return false
+}
+
+// readRTCP reads the sender's RTCP so interceptors keep processing it and
+// reports keyframe requests to onKeyframeRequest, which may be nil
+func readRTCP(sender *webrtc.RTPSender, onKeyframeRequest func()) {
+	for {
+		packets, _, err := sender.ReadRTCP()
+		if err != nil {
+			return
+		}
+		if onKeyframeRequest == nil {
+			continue
+		}
+		for _, packet := range packets {
+			switch packet.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				onKeyframeRequest()
+			}
+		}
+	}
+}
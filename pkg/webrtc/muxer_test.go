@@ -0,0 +1,32 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/deepch/vdk/av"
+)
+
+func TestTrackSkipsReplayedPackets(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name   string
+		replay time.Duration // time of the last replayed packet
+		live   []time.Duration
+		want   []bool
+	}{
+		{"queued packets up to the replay", 80 * ms, []time.Duration{40 * ms, 80 * ms, 120 * ms}, []bool{true, true, false}},
+		{"newer packet ends the check", 80 * ms, []time.Duration{120 * ms, 40 * ms}, []bool{false, false}},
+		{"restarted source", 30 * time.Second, []time.Duration{0, 40 * ms}, []bool{false, false}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			track := &track{replayed: true, replayedUntil: tt.replay}
+			for i, at := range tt.live {
+				if got := track.skipReplayed(av.Packet{Time: at}); got != tt.want[i] {
+					t.Errorf("packet at %s: skipped %v, want %v", at, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
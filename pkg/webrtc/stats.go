@@ -0,0 +1,196 @@
+package webrtc
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pion/interceptor"
+	rtpstats "github.com/pion/interceptor/pkg/stats"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+// bitrateWindow is the interval the outgoing bitrate is sampled at
+const bitrateWindow = time.Second
+
+// Stats describes the quality of the connection to a viewer
+type Stats struct {
+	// LocalCandidate and RemoteCandidate are the types of the selected
+	// candidate pair: "host", "srflx", "prflx" or "relay". They are empty
+	// until ICE connects.
+	LocalCandidate  string
+	RemoteCandidate string
+	Protocol        string // "udp" or "tcp"
+	Connected       time.Time
+
+	// RTT is measured from the viewer's receiver reports, or by ICE until
+	// the first report arrives
+	RTT time.Duration
+	// Jitter and FractionLost are the largest the viewer reported across
+	// tracks; FractionLost covers the last report interval
+	Jitter       time.Duration
+	FractionLost float64
+	PacketsLost  int64
+	PacketsSent  uint64
+	BytesSent    uint64
+	NACKs        uint32
+	PLIs         uint32
+	FIRs         uint32
+	// Bitrate is the outgoing bits per second over the last sample
+	Bitrate float64
+}
+
+// Stats returns the current quality of the connection
+func (element *Muxer) Stats() Stats {
+	element.mu.Lock()
+	getter, rate := element.stats, element.rate
+	connected := element.connected
+	ssrcs := make([]uint32, 0, len(element.streams))
+	for _, t := range element.streams {
+		ssrcs = append(ssrcs, t.ssrc)
+	}
+	element.mu.Unlock()
+
+	s := Stats{Connected: connected}
+	if pair := element.SelectedCandidatePair(); pair != nil {
+		s.LocalCandidate = pair.Local.Typ.String()
+		s.RemoteCandidate = pair.Remote.Typ.String()
+		s.Protocol = pair.Local.Protocol.String()
+	}
+	if getter != nil {
+		for _, ssrc := range ssrcs {
+			track := getter.Get(ssrc)
+			if track == nil {
+				continue
+			}
+			addTrackStats(&s, track)
+		}
+	}
+	if s.RTT == 0 {
+		s.RTT = element.iceRTT()
+	}
+	if rate != nil {
+		s.Bitrate = rate.Bitrate()
+	}
+	return s
+}
+
+func addTrackStats(s *Stats, track *rtpstats.Stats) {
+	out, remote := track.OutboundRTPStreamStats, track.RemoteInboundRTPStreamStats
+	s.PacketsSent += out.PacketsSent
+	s.BytesSent += out.BytesSent
+	s.NACKs += out.NACKCount
+	s.PLIs += out.PLICount
+	s.FIRs += out.FIRCount
+	s.PacketsLost += remote.PacketsLost
+	if remote.RoundTripTime > s.RTT {
+		s.RTT = remote.RoundTripTime
+	}
+	if jitter := time.Duration(remote.Jitter * float64(time.Second)); jitter > s.Jitter {
+		s.Jitter = jitter
+	}
+	if remote.FractionLost > s.FractionLost {
+		s.FractionLost = remote.FractionLost
+	}
+}
+
+// iceRTT returns the round trip time of the selected candidate pair
+func (element *Muxer) iceRTT() time.Duration {
+	element.mu.Lock()
+	peerConnection := element.pc
+	element.mu.Unlock()
+	if peerConnection == nil {
+		return 0
+	}
+	for _, report := range peerConnection.GetStats() {
+		pair, ok := report.(webrtc.ICECandidatePairStats)
+		if ok && pair.Nominated && pair.State == webrtc.StatsICECandidatePairStateSucceeded {
+			return time.Duration(pair.CurrentRoundTripTime * float64(time.Second))
+		}
+	}
+	return 0
+}
+
+// bitrateFactory builds the bitrate interceptor of a peer connection and
+// hands it to onNew
+type bitrateFactory struct {
+	onNew func(*bitrateInterceptor)
+}
+
+// NewInterceptor implements interceptor.Factory
+func (f bitrateFactory) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	i := newBitrateInterceptor()
+	f.onNew(i)
+	return i, nil
+}
+
+// bitrateInterceptor counts the RTP bytes written to a peer connection and
+// samples the outgoing bitrate every bitrateWindow until it is closed
+type bitrateInterceptor struct {
+	interceptor.NoOp
+
+	bytes atomic.Uint64
+	// bitrate holds the bits of the last sampled float64
+	bitrate atomic.Uint64
+
+	// last and at are the byte count and time of the last sample; only the
+	// sampling goroutine uses them
+	last uint64
+	at   time.Time
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newBitrateInterceptor() *bitrateInterceptor {
+	i := &bitrateInterceptor{at: time.Now(), done: make(chan struct{})}
+	go i.run()
+	return i
+}
+
+func (i *bitrateInterceptor) run() {
+	ticker := time.NewTicker(bitrateWindow)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-i.done:
+			return
+		case now := <-ticker.C:
+			i.sample(now)
+		}
+	}
+}
+
+// sample stores the bitrate since the previous sample
+func (i *bitrateInterceptor) sample(now time.Time) {
+	bytes := i.bytes.Load()
+	if elapsed := now.Sub(i.at); elapsed > 0 {
+		i.bitrate.Store(math.Float64bits(float64(bytes-i.last) * 8 / elapsed.Seconds()))
+	}
+	i.last, i.at = bytes, now
+}
+
+// Bitrate returns the outgoing bits per second of the last sample
+func (i *bitrateInterceptor) Bitrate() float64 {
+	return math.Float64frombits(i.bitrate.Load())
+}
+
+// BindLocalStream counts the header and payload bytes of every packet
+// written to the stream
+func (i *bitrateInterceptor) BindLocalStream(_ *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		n, err := writer.Write(header, payload, attributes)
+		if err == nil {
+			i.bytes.Add(uint64(header.MarshalSize() + len(payload)))
+		}
+		return n, err
+	})
+}
+
+// Close stops sampling
+func (i *bitrateInterceptor) Close() error {
+	i.closeOnce.Do(func() { close(i.done) })
+	return nil
+}
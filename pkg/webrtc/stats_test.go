@@ -0,0 +1,55 @@
+package webrtc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+func TestBitrateInterceptorSamples(t *testing.T) {
+	start := time.Unix(1700000000, 0)
+	rate := &bitrateInterceptor{at: start, done: make(chan struct{})}
+	writer := rate.BindLocalStream(nil, interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, _ interceptor.Attributes) (int, error) {
+		return header.MarshalSize() + len(payload), nil
+	}))
+	write := func(packets int) {
+		for n := 0; n < packets; n++ {
+			// 12 header bytes and 113 payload bytes make 1000 bits
+			if _, err := writer.Write(&rtp.Header{Version: 2}, make([]byte, 113), nil); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+		}
+	}
+	element := &Muxer{rate: rate}
+
+	tests := []struct {
+		name    string
+		packets int
+		elapsed time.Duration
+		want    float64
+	}{
+		{"first second", 50, time.Second, 50000},
+		{"half a second", 10, 500 * time.Millisecond, 20000},
+		{"idle", 0, time.Second, 0},
+	}
+	at := start
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := element.Stats().Bitrate
+			write(tt.packets)
+			// writes between samples do not show until the next tick
+			if got := element.Stats().Bitrate; got != before {
+				t.Fatalf("bitrate %v before the sample, want %v", got, before)
+			}
+			at = at.Add(tt.elapsed)
+			rate.sample(at)
+			for i := 0; i < 3; i++ {
+				if got := element.Stats().Bitrate; got != tt.want {
+					t.Errorf("read %d: bitrate %v, want %v", i, got, tt.want)
+				}
+			}
+		})
+	}
+}
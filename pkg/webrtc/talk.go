@@ -0,0 +1,93 @@
+package webrtc
+
+import (
+	"strings"
+	"time"
+
+	"github.com/deepch/vdk/av"
+	"github.com/deepch/vdk/codec"
+	"github.com/pion/webrtc/v3"
+)
+
+// talkCodecPreferences orders the audio codecs of the answer so that
+// browsers send their microphone in G.711, which cameras accept without
+// transcoding. Opus stays last for tracks of the stream in Opus.
+var talkCodecPreferences = []webrtc.RTPCodecParameters{
+	{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMA, ClockRate: 8000}},
+	{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypePCMU, ClockRate: 8000}},
+	{RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeOpus, ClockRate: 48000, Channels: 2, SDPFmtpLine: "minptime=10;useinbandfec=1"}},
+}
+
+// AudioTrack is the microphone audio the peer sends
+type AudioTrack struct {
+	remote *webrtc.TrackRemote
+	codec  av.AudioCodecData
+
+	started bool
+	base    uint32
+}
+
+func newAudioTrack(remote *webrtc.TrackRemote) *AudioTrack {
+	t := &AudioTrack{remote: remote}
+	switch strings.ToLower(remote.Codec().MimeType) {
+	case strings.ToLower(webrtc.MimeTypePCMA):
+		t.codec = codec.NewPCMAlawCodecData()
+	case strings.ToLower(webrtc.MimeTypePCMU):
+		t.codec = codec.NewPCMMulawCodecData()
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		t.codec = codec.NewOpusCodecData(48000, av.CH_MONO)
+	}
+	return t
+}
+
+// Codec returns the codec of the track, or nil when the peer sends one
+// that cannot be converted
+func (t *AudioTrack) Codec() av.AudioCodecData {
+	return t.codec
+}
+
+// ReadPacket returns the next frame with index 0, timed from the first
+func (t *AudioTrack) ReadPacket() (av.Packet, error) {
+	packet, _, err := t.remote.ReadRTP()
+	if err != nil {
+		return av.Packet{}, err
+	}
+	if !t.started {
+		t.started = true
+		t.base = packet.Timestamp
+	}
+	elapsed := time.Duration(packet.Timestamp-t.base) * time.Second / time.Duration(t.remote.Codec().ClockRate)
+	return av.Packet{Data: packet.Payload, Time: elapsed}, nil
+}
+
+// acceptAudio passes the peer's audio to Options.OnAudio, receiving it on a
+// transceiver of its own when the stream has no audio track
+func (element *Muxer) acceptAudio(peerConnection *webrtc.PeerConnection) error {
+	hasAudio := false
+	for _, t := range element.streams {
+		hasAudio = hasAudio || t.codec.Type().IsAudio()
+	}
+	if !hasAudio {
+		if _, err := peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeAudio, webrtc.RTPTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionRecvonly,
+		}); err != nil {
+			return err
+		}
+	}
+	for _, transceiver := range peerConnection.GetTransceivers() {
+		if transceiver.Kind() != webrtc.RTPCodecTypeAudio {
+			continue
+		}
+		if err := transceiver.SetCodecPreferences(talkCodecPreferences); err != nil {
+			return err
+		}
+	}
+
+	onAudio := element.Options.OnAudio
+	peerConnection.OnTrack(func(remote *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		if remote.Kind() == webrtc.RTPCodecTypeAudio {
+			onAudio(newAudioTrack(remote))
+		}
+	})
+	return nil
+}